@@ -11,6 +11,8 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/j-vizcaino/datadog-smartctl/converter"
+	"github.com/j-vizcaino/datadog-smartctl/selftest"
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
 )
 
 var defaultConfig = Config{
@@ -19,6 +21,12 @@ var defaultConfig = Config{
 		Binary:          "smartctl",
 		UseSudo:         false,
 	},
+	SelfTestScheduler: SelfTestSchedulerConfig{
+		CheckInterval: time.Minute,
+	},
+	Helper: HelperConfig{
+		Socket: "/run/datadog-smartctl/helper.sock",
+	},
 	Statsd: StatsdConfig{
 		URL:            "localhost:8125",
 		MetricsPrefix:  "smartctl.",
@@ -28,9 +36,13 @@ var defaultConfig = Config{
 }
 
 type Config struct {
-	Smartctl SmartCtlConfig `yaml:"smartctl"`
-	Statsd   StatsdConfig   `yaml:"statsd"`
-	Devices  []DeviceConfig `yaml:"devices"`
+	Smartctl          SmartCtlConfig            `yaml:"smartctl"`
+	Statsd            StatsdConfig              `yaml:"statsd"`
+	Discovery         DiscoveryConfig           `yaml:"discovery"`
+	SelfTestScheduler SelfTestSchedulerConfig   `yaml:"self_test_scheduler"`
+	Helper            HelperConfig              `yaml:"helper"`
+	Profiles          map[string]CommandProfile `yaml:"profiles"`
+	Devices           []DeviceConfig            `yaml:"devices"`
 }
 
 type StatsdConfig struct {
@@ -43,14 +55,321 @@ type StatsdConfig struct {
 type SmartCtlConfig struct {
 	PollingInterval time.Duration `yaml:"polling_interval"`
 	Binary          string        `yaml:"binary"`
-	UseSudo         bool          `yaml:"use_sudo"`
+	// UseSudo is a shorthand for the sudo executor, Executor taking
+	// precedence when set.
+	UseSudo  bool           `yaml:"use_sudo"`
+	Executor ExecutorConfig `yaml:"executor"`
+	// AllowUnsupportedVersion only warns, instead of refusing to start, when a
+	// smartctl binary does not support JSON output.
+	AllowUnsupportedVersion bool               `yaml:"allow_unsupported_version"`
+	RawDecoderRules         []RawDecoderConfig `yaml:"raw_decoders"`
+	// DriveDB is a drive database file read in addition to the default one,
+	// and AttributePresets are passed as smartctl -v ID,FORMAT[,NAME[,HDD|SSD]].
+	DriveDB          string   `yaml:"drivedb"`
+	AttributePresets []string `yaml:"attribute_presets"`
+	// MaxParallelQueries bounds the number of devices queried at the same
+	// time, unbounded when 0. SerializeBy queries a single device at a time
+	// per RAID controller ("controller") or per SCSI host ("host").
+	MaxParallelQueries int              `yaml:"max_parallel_queries"`
+	SerializeBy        smartctl.GroupBy `yaml:"serialize_by"`
+}
+
+// CommandProfile returns the smartctl settings all the devices start from.
+func (s SmartCtlConfig) CommandProfile() CommandProfile {
+	useSudo := s.UseSudo
+	return CommandProfile{
+		Binary:           s.Binary,
+		UseSudo:          &useSudo,
+		Executor:         s.Executor,
+		RawDecoderRules:  s.RawDecoderRules,
+		DriveDB:          s.DriveDB,
+		AttributePresets: s.AttributePresets,
+	}
+}
+
+// ExecutorConfig selects how smartctl is run: direct, sudo, doas, nsenter (in
+// the mount namespace of TargetPID, 1 by default) or prefix (as the argument
+// of Command, e.g. a wrapper script).
+type ExecutorConfig struct {
+	Type      string   `yaml:"type"`
+	TargetPID int      `yaml:"target_pid"`
+	Command   []string `yaml:"command"`
+}
+
+func (e ExecutorConfig) Executor() (smartctl.Executor, error) {
+	return smartctl.NewExecutor(e.Type, e.TargetPID, e.Command)
+}
+
+// RawDecoderConfig selects the decoder of the ATA SMART attribute raw values
+// matching ID or Name, and optionally the model family regular expression.
+// With a Part, the decoded value is reported as a separate metric named after
+// the part, the attribute metric keeping its value.
+type RawDecoderConfig struct {
+	ID          int    `yaml:"id"`
+	Name        string `yaml:"name"`
+	ModelFamily string `yaml:"model_family"`
+	Decoder     string `yaml:"decoder"`
+	Part        string `yaml:"part"`
+}
+
+func (r RawDecoderConfig) Rule() smartctl.RawDecoderRule {
+	return smartctl.RawDecoderRule{
+		ID:          r.ID,
+		Name:        r.Name,
+		ModelFamily: r.ModelFamily,
+		Decoder:     r.Decoder,
+		Part:        r.Part,
+	}
+}
+
+// CommandProfile holds the smartctl settings of a device. Unset fields keep
+// the value of the profile they are merged onto.
+type CommandProfile struct {
+	Type      string        `yaml:"type"`
+	ExtraArgs []string      `yaml:"extra_args"`
+	Timeout   time.Duration `yaml:"timeout"`
+	Binary    string        `yaml:"binary"`
+	UseSudo   *bool         `yaml:"use_sudo"`
+	// Executor runs smartctl through another command, see ExecutorConfig.
+	Executor ExecutorConfig `yaml:"executor"`
+	// SkipIfInPowerMode avoids spinning up devices in the given power mode or
+	// a lower one: never, sleep, standby or idle.
+	SkipIfInPowerMode smartctl.SkipPowerMode `yaml:"skip_if_in_power_mode"`
+	// RawDecoderRules decode ATA SMART attribute raw values, the first
+	// matching rule applying.
+	RawDecoderRules []RawDecoderConfig `yaml:"raw_decoders"`
+	// DriveDB is a drive database file (smartctl -B), read in addition to the
+	// default one.
+	DriveDB string `yaml:"drivedb"`
+	// AttributePresets relabel ATA SMART attributes (smartctl -v), e.g.
+	// "1,raw48,Raw_Read_Error_Rate".
+	AttributePresets []string `yaml:"attribute_presets"`
+}
+
+// Merge returns the profile overridden by the settings of other. Extra
+// arguments and attribute presets add up, and raw decoder rules of other take
+// precedence.
+func (p CommandProfile) Merge(other CommandProfile) CommandProfile {
+	if other.Type != "" {
+		p.Type = other.Type
+	}
+	if len(other.ExtraArgs) > 0 {
+		args := make([]string, 0, len(p.ExtraArgs)+len(other.ExtraArgs))
+		args = append(args, p.ExtraArgs...)
+		p.ExtraArgs = append(args, other.ExtraArgs...)
+	}
+	if other.Timeout != 0 {
+		p.Timeout = other.Timeout
+	}
+	if other.Binary != "" {
+		p.Binary = other.Binary
+	}
+	// The latest setting wins, use_sudo: false meaning running smartctl directly
+	if other.UseSudo != nil {
+		p.UseSudo = other.UseSudo
+		p.Executor = ExecutorConfig{}
+	}
+	if other.Executor.Type != "" {
+		p.Executor = other.Executor
+	}
+	if other.SkipIfInPowerMode != "" {
+		p.SkipIfInPowerMode = other.SkipIfInPowerMode
+	}
+	if other.DriveDB != "" {
+		p.DriveDB = other.DriveDB
+	}
+	if len(other.AttributePresets) > 0 {
+		presets := make([]string, 0, len(p.AttributePresets)+len(other.AttributePresets))
+		presets = append(presets, p.AttributePresets...)
+		p.AttributePresets = append(presets, other.AttributePresets...)
+	}
+	if len(other.RawDecoderRules) > 0 {
+		rules := make([]RawDecoderConfig, 0, len(p.RawDecoderRules)+len(other.RawDecoderRules))
+		rules = append(rules, other.RawDecoderRules...)
+		p.RawDecoderRules = append(rules, p.RawDecoderRules...)
+	}
+	return p
+}
+
+// ExecutorConfig returns the executor of the profile, sudo when only UseSudo
+// is set.
+func (p CommandProfile) ExecutorConfig() ExecutorConfig {
+	if p.Executor.Type == "" && p.UseSudo != nil && *p.UseSudo {
+		return ExecutorConfig{Type: smartctl.ExecutorSudo}
+	}
+	return p.Executor
+}
+
+// RawDecoders returns the decoders of the profile rules, followed by the
+// default ones.
+func (p CommandProfile) RawDecoders() (*smartctl.RawDecoders, error) {
+	rules := make([]smartctl.RawDecoderRule, 0, len(p.RawDecoderRules))
+	for _, rule := range p.RawDecoderRules {
+		rules = append(rules, rule.Rule())
+	}
+	return smartctl.NewRawDecoders(rules...)
+}
+
+// HelperConfig makes the daemon query devices through the privileged helper
+// (datadog-smartctl helper), listening on Socket. The helper reads the same
+// configuration and only queries the configured devices, the daemon then
+// running unprivileged.
+// The socket is only accessible to SocketGroup (name or ID), which the daemon
+// must belong to. The socket directory is created when missing, accessible to
+// the same group.
+type HelperConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Socket      string `yaml:"socket"`
+	SocketGroup string `yaml:"socket_group"`
 }
 
+// DiscoveryConfig enables automatic device detection using smartctl --scan-open.
+// Detected devices are matched against the include/exclude patterns, then
+// monitored using the metric set defined for their protocol (ATA, NVMe, SCSI).
+// Devices explicitly listed in Config.Devices take precedence.
+type DiscoveryConfig struct {
+	Enabled   bool                     `yaml:"enabled"`
+	Include   []string                 `yaml:"include"`
+	Exclude   []string                 `yaml:"exclude"`
+	Protocols map[string]MetricsConfig `yaml:"protocols"`
+}
+
+// SelfTestSchedulerConfig applies to all the devices with self-test schedules.
+// Stagger delays the schedules of each device by an additional amount, so
+// that tests do not start at the same time on all disks.
+type SelfTestSchedulerConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	Stagger       time.Duration `yaml:"stagger"`
+}
+
+func (p CommandProfile) Errors() []string {
+	var errorList []string
+	if p.Timeout < 0 {
+		errorList = append(errorList, fmt.Sprintf("timeout must be positive (got %s)", p.Timeout.String()))
+	}
+	if p.SkipIfInPowerMode != "" && !p.SkipIfInPowerMode.Valid() {
+		errorList = append(errorList, fmt.Sprintf("unsupported skip_if_in_power_mode %q, expected never, sleep, standby or idle", p.SkipIfInPowerMode))
+	}
+	if _, err := p.ExecutorConfig().Executor(); err != nil {
+		errorList = append(errorList, err.Error())
+	}
+	if _, err := p.RawDecoders(); err != nil {
+		errorList = append(errorList, err.Error())
+	}
+	for _, preset := range p.AttributePresets {
+		if err := smartctl.ValidateAttributePreset(preset); err != nil {
+			errorList = append(errorList, err.Error())
+		}
+	}
+	return errorList
+}
+
+// DeviceConfig describes a device to monitor. Type is passed to smartctl as
+// the device type (-d), e.g. "megaraid,3" for a disk behind a RAID controller.
+// Members lists several disks behind the same RAID controller at once, Type
+// being the controller type, e.g. "megaraid" or "sat+megaraid".
+// Profile names an entry of Config.Profiles, the smartctl settings of the
+// device taking precedence over it.
 type DeviceConfig struct {
-	Path                      string   `yaml:"path"`
+	Path           string                   `yaml:"path"`
+	Profile        string                   `yaml:"profile"`
+	Members        []string                 `yaml:"members"`
+	SelfTests      []SelfTestScheduleConfig `yaml:"self_tests"`
+	CommandProfile `yaml:",inline"`
+	MetricsConfig  `yaml:",inline"`
+}
+
+func (d DeviceConfig) Device() smartctl.Device {
+	return smartctl.Device{
+		Path: d.Path,
+		Type: d.Type,
+	}
+}
+
+// Expand returns one device configuration per RAID controller member, the
+// device configuration itself when no members are listed.
+func (d DeviceConfig) Expand() []DeviceConfig {
+	if len(d.Members) == 0 {
+		return []DeviceConfig{d}
+	}
+	out := make([]DeviceConfig, 0, len(d.Members))
+	for _, member := range d.Members {
+		dev := d
+		dev.Type = d.Type + "," + member
+		dev.Members = nil
+		out = append(out, dev)
+	}
+	return out
+}
+
+// SelfTestScheduleConfig starts a self-test every given duration, the first
+// test starting at the given time of day (e.g. "03:00").
+type SelfTestScheduleConfig struct {
+	Type  string        `yaml:"type"`
+	Every time.Duration `yaml:"every"`
+	At    string        `yaml:"at"`
+}
+
+func (s SelfTestScheduleConfig) Schedule() (selftest.Schedule, error) {
+	testType := smartctl.SelfTestType(s.Type)
+	if !testType.Valid() {
+		return selftest.Schedule{}, fmt.Errorf("unsupported self-test type %q", s.Type)
+	}
+	if s.Every < time.Hour {
+		return selftest.Schedule{}, fmt.Errorf("%s self-test must be at least one hour apart (got %s)", s.Type, s.Every)
+	}
+	at, err := time.Parse("15:04", s.At)
+	if err != nil {
+		return selftest.Schedule{}, fmt.Errorf("invalid %s self-test time of day %q, expected HH:MM", s.Type, s.At)
+	}
+	return selftest.Schedule{
+		Type:     testType,
+		Interval: s.Every,
+		At:       time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute,
+	}, nil
+}
+
+type MetricsConfig struct {
+	// ATASmartAttributesMetrics selects attributes by lower-cased name or by
+	// ID, as in "id:5" or "5". Each attribute reports its decoded raw value,
+	// normalized value, worst value, threshold and threshold margin, the
+	// margin being omitted for attributes with a zero threshold.
 	ATASmartAttributesMetrics []string `yaml:"ata_smart_attributes_metrics"`
 	ATADeviceStatsMetrics     []string `yaml:"ata_device_stats_metrics"`
-	NVMeHealthInfoMetrics     []string `yaml:"nvme_health_info_metrics"`
+	ATASelfTestLog            bool     `yaml:"ata_self_test_log"`
+	ATAErrorLog               bool     `yaml:"ata_error_log"`
+	ATASCTStatus              bool     `yaml:"ata_sct_status"`
+	ATASCTTemperatureHistory  bool     `yaml:"ata_sct_temperature_history"`
+	// SATAPhyEventCountersMetrics selects counters by ID or normalized name.
+	SATAPhyEventCountersMetrics []string `yaml:"sata_phy_event_counters_metrics"`
+	NVMeHealthInfoMetrics       []string `yaml:"nvme_health_info_metrics"`
+	// NVMeErrorInfoLogMetrics selects among error_count, unread, entries and last_status_code.
+	NVMeErrorInfoLogMetrics []string `yaml:"nvme_error_info_log_metrics"`
+	// NVMeSelfTestLogMetrics selects among in_progress, completion_percent,
+	// failed_count, last_result, last_failed and last_hours_ago.
+	NVMeSelfTestLogMetrics      []string `yaml:"nvme_self_test_log_metrics"`
+	SCSIGrownDefectList         bool     `yaml:"scsi_grown_defect_list"`
+	SCSIErrorCounterLog         bool     `yaml:"scsi_error_counter_log"`
+	SCSIStartStopCycleCounter   bool     `yaml:"scsi_start_stop_cycle_counter"`
+	SCSIPercentageUsedEndurance bool     `yaml:"scsi_percentage_used_endurance"`
+	SCSITemperature             bool     `yaml:"scsi_temperature"`
+}
+
+func (d DiscoveryConfig) Filter() smartctl.DeviceFilter {
+	return smartctl.DeviceFilter{
+		Include: d.Include,
+		Exclude: d.Exclude,
+	}
+}
+
+// ProtocolMetrics returns the metric set to use for a detected device protocol.
+func (d DiscoveryConfig) ProtocolMetrics(protocol string) (MetricsConfig, bool) {
+	for name, metrics := range d.Protocols {
+		if strings.EqualFold(name, protocol) {
+			return metrics, true
+		}
+	}
+	return MetricsConfig{}, false
 }
 
 func MustLoadValidConfig(filename string) Config {
@@ -97,11 +416,20 @@ func (c Config) Errors() []string {
 		}
 	}
 
-	addErrIf(len(c.Devices) == 0, "devices are not specified")
+	addErrIf(len(c.Devices) == 0 && !c.Discovery.Enabled, "devices are not specified and discovery is disabled")
 	addErrIf(c.Smartctl.Binary == "", "smartctl binary is empty")
 	addErrIf(c.Smartctl.PollingInterval < time.Second,
 		"smartctl polling interval must be at least one second (got %s)",
 		c.Smartctl.PollingInterval.String())
+	for _, err := range c.Smartctl.CommandProfile().Errors() {
+		addErr("smartctl %s", err)
+	}
+	addErrIf(c.Smartctl.MaxParallelQueries < 0,
+		"smartctl max parallel queries must be positive (got %d)",
+		c.Smartctl.MaxParallelQueries)
+	addErrIf(!c.Smartctl.SerializeBy.Valid(),
+		"unsupported smartctl serialize_by %q, expected controller or host",
+		c.Smartctl.SerializeBy)
 
 	addErrIf(c.Statsd.MetricsPrefix == "", "metric prefix is not specified")
 	addErrIf(c.Statsd.URL == "", "statsd URL is empty")
@@ -111,20 +439,140 @@ func (c Config) Errors() []string {
 	unknownTags := converter.UnknownTags(c.Statsd.DeviceTags)
 	addErrIf(len(unknownTags) > 0, "unknown device tags %s", strings.Join(unknownTags, ", "))
 
+	for name, profile := range c.Profiles {
+		for _, err := range profile.Errors() {
+			addErr("profile %s %s", name, err)
+		}
+	}
+
+	addErrIf(c.SelfTestScheduler.CheckInterval < time.Second,
+		"self-test scheduler check interval must be at least one second (got %s)",
+		c.SelfTestScheduler.CheckInterval.String())
+
+	if c.Helper.Enabled {
+		addErrIf(c.Helper.Socket == "", "helper socket is empty")
+		// Only device queries go through the helper
+		addErrIf(c.Discovery.Enabled, "discovery is not supported through the helper")
+	}
+
+	if c.Discovery.Enabled {
+		if err := c.Discovery.Filter().Validate(); err != nil {
+			addErr("discovery: %s", err)
+		}
+		addErrIf(len(c.Discovery.Protocols) == 0, "discovery must specify metrics for at least one protocol")
+		for protocol, metrics := range c.Discovery.Protocols {
+			for _, err := range metrics.Errors() {
+				addErr("discovery protocol %s %s", protocol, err)
+			}
+		}
+	}
+
 	for idx, dev := range c.Devices {
 		if dev.Path == "" {
 			addErr("devices[%d] must specify a path", idx)
 			continue
 		}
-		ataMetrics := len(dev.ATADeviceStatsMetrics) + len(dev.ATASmartAttributesMetrics)
-		nvmeMetrics := len(dev.NVMeHealthInfoMetrics)
-		addErrIf(ataMetrics+nvmeMetrics == 0,
-			"device %s must specify at least one of ATA or NVMe metrics",
-			dev.Path)
+		if _, ok := c.Profiles[dev.Profile]; dev.Profile != "" && !ok {
+			addErr("device %s uses unknown profile %q", dev.Path, dev.Profile)
+		}
+		dev = c.resolveProfile(dev)
+		for _, err := range dev.CommandProfile.Errors() {
+			addErr("device %s %s", dev.Path, err)
+		}
+		addErrIf(len(dev.Members) > 0 && !smartctl.IsControllerType(dev.Type),
+			"device %s members require a RAID controller type (megaraid, cciss or areca), got %q", dev.Path, dev.Type)
+		for _, err := range dev.MetricsConfig.Errors() {
+			addErr("device %s %s", dev.Path, err)
+		}
+		for _, schedule := range dev.SelfTests {
+			if _, err := schedule.Schedule(); err != nil {
+				addErr("device %s %s", dev.Path, err)
+			}
+		}
+		// The scheduler relies on the ATA self-test status
+		_, nvmeMetrics, scsiMetrics := dev.MetricsConfig.protocolMetrics()
+		addErrIf(len(dev.SelfTests) > 0 && (nvmeMetrics > 0 || scsiMetrics > 0 || dev.Type == "nvme"),
+			"device %s self-tests are only supported on ATA devices", dev.Path)
+		if c.Helper.Enabled {
+			if err := smartctl.ValidateDevice(dev.Device()); err != nil {
+				addErr("device %s %s", dev.Path, err)
+			}
+			addErrIf(len(dev.SelfTests) > 0, "device %s self-tests are not supported through the helper", dev.Path)
+		}
+	}
+	return errorList
+}
+
+// MonitoredDevices returns the configured devices, with their complete
+// smartctl settings. RAID controller members are expanded into individual devices.
+func (c Config) MonitoredDevices() []DeviceConfig {
+	var out []DeviceConfig
+	for _, dev := range c.Devices {
+		out = append(out, c.resolveProfile(dev).Expand()...)
+	}
+	return out
+}
+
+// resolveProfile merges the global smartctl settings, the device profile and
+// the device settings, in that order.
+func (c Config) resolveProfile(dev DeviceConfig) DeviceConfig {
+	profile := c.Smartctl.CommandProfile()
+	if dev.Profile != "" {
+		profile = profile.Merge(c.Profiles[dev.Profile])
+	}
+	dev.CommandProfile = profile.Merge(dev.CommandProfile)
+	return dev
+}
+
+// SmartctlLogs returns the device logs, not requested by default, needed for the metrics.
+func (m MetricsConfig) SmartctlLogs() []string {
+	var logs []string
+	if m.ATASCTStatus {
+		logs = append(logs, "scttempsts")
+	}
+	if m.ATASCTTemperatureHistory {
+		logs = append(logs, "scttemp")
+	}
+	if len(m.SATAPhyEventCountersMetrics) > 0 {
+		logs = append(logs, "sataphy")
+	}
+	return logs
+}
 
-		addErrIf(ataMetrics != 0 && nvmeMetrics != 0,
-			"device %s cannot specify both ATA and NVMe metrics",
-			dev.Path)
+func (m MetricsConfig) Errors() []string {
+	var errorList []string
+	ataMetrics, nvmeMetrics, scsiMetrics := m.protocolMetrics()
+	protocols := 0
+	for _, count := range []int{ataMetrics, nvmeMetrics, scsiMetrics} {
+		if count != 0 {
+			protocols++
+		}
+	}
+	if protocols == 0 {
+		errorList = append(errorList, "must specify at least one of ATA, NVMe or SCSI metrics")
+	}
+	if protocols > 1 {
+		errorList = append(errorList, "cannot specify metrics of more than one protocol among ATA, NVMe and SCSI")
+	}
+	for _, err := range converter.InvalidATAAttributeSelectors(m.ATASmartAttributesMetrics) {
+		errorList = append(errorList, err.Error())
 	}
 	return errorList
 }
+
+// protocolMetrics returns the number of ATA, NVMe and SCSI metrics selected.
+func (m MetricsConfig) protocolMetrics() (ataMetrics, nvmeMetrics, scsiMetrics int) {
+	ataMetrics = len(m.ATADeviceStatsMetrics) + len(m.ATASmartAttributesMetrics) + len(m.SATAPhyEventCountersMetrics)
+	for _, enabled := range []bool{m.ATASelfTestLog, m.ATAErrorLog, m.ATASCTStatus, m.ATASCTTemperatureHistory} {
+		if enabled {
+			ataMetrics++
+		}
+	}
+	nvmeMetrics = len(m.NVMeHealthInfoMetrics) + len(m.NVMeErrorInfoLogMetrics) + len(m.NVMeSelfTestLogMetrics)
+	for _, enabled := range []bool{m.SCSIGrownDefectList, m.SCSIErrorCounterLog, m.SCSIStartStopCycleCounter, m.SCSIPercentageUsedEndurance, m.SCSITemperature} {
+		if enabled {
+			scsiMetrics++
+		}
+	}
+	return ataMetrics, nvmeMetrics, scsiMetrics
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
+)
+
+// ataAttributeSelector selects ATA SMART attributes by ID, or by lower-cased
+// name when id is zero.
+type ataAttributeSelector struct {
+	id   int
+	name string
+}
+
+// parseATAAttributeSelector parses "id:5" or "5" as an ID, anything else as a
+// name.
+func parseATAAttributeSelector(entry string) (ataAttributeSelector, error) {
+	value := strings.TrimPrefix(entry, "id:")
+	id, err := strconv.Atoi(value)
+	if err == nil && id > 0 && id < 256 {
+		return ataAttributeSelector{id: id}, nil
+	}
+	if value != entry || err == nil {
+		return ataAttributeSelector{}, fmt.Errorf("invalid ATA SMART attribute ID %q, expected 1 to 255", entry)
+	}
+	return ataAttributeSelector{name: strings.ToLower(entry)}, nil
+}
+
+// parseATAAttributeSelectors ignores invalid entries, see InvalidATAAttributeSelectors.
+func parseATAAttributeSelectors(entries []string) []ataAttributeSelector {
+	out := make([]ataAttributeSelector, 0, len(entries))
+	for _, entry := range entries {
+		if selector, err := parseATAAttributeSelector(entry); err == nil {
+			out = append(out, selector)
+		}
+	}
+	return out
+}
+
+// InvalidATAAttributeSelectors returns the errors of the ATA SMART attribute
+// entries which are neither names nor IDs.
+func InvalidATAAttributeSelectors(entries []string) []error {
+	var errs []error
+	for _, entry := range entries {
+		if _, err := parseATAAttributeSelector(entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (s ataAttributeSelector) match(attr smartctl.ATASmartAttribute) bool {
+	if s.id != 0 {
+		return s.id == attr.ID
+	}
+	return s.name == strings.ToLower(attr.Name)
+}
+
+// selectATASmartAttributes returns the attributes matching the selectors, in
+// the selectors order. All the attributes sharing a selected name are returned,
+// each attribute being returned once.
+func selectATASmartAttributes(table []smartctl.ATASmartAttribute, selectors []ataAttributeSelector) []smartctl.ATASmartAttribute {
+	var out []smartctl.ATASmartAttribute
+	selected := make(map[int]bool)
+	for _, selector := range selectors {
+		for _, attr := range table {
+			if selected[attr.ID] || !selector.match(attr) {
+				continue
+			}
+			selected[attr.ID] = true
+			out = append(out, attr)
+		}
+	}
+	return out
+}
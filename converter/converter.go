@@ -2,7 +2,10 @@ package converter
 
 import (
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/scylladb/go-set/strset"
 
@@ -15,9 +18,11 @@ func init() {
 }
 
 type Converter struct {
-	metricPrefix string
-	commonTags   *strset.Set
-	extractors   []metricsExtractor
+	metricPrefix  string
+	commonTags    *strset.Set
+	extractors    []metricsExtractor
+	serviceChecks []serviceCheckExtractor
+	powerMode     metricsExtractor
 }
 
 type Option func(converter *Converter)
@@ -28,13 +33,20 @@ func WithTags(tagNames ...string) Option {
 	}
 }
 
+// WithATASmartAttributes reports the selected ATA SMART attributes, by
+// lower-cased name or by ID ("id:5" or "5"). Metrics are named after the
+// attribute and tagged with its ID: the decoded raw value, and the normalized
+// value, worst value, threshold and threshold margin (value - threshold) as
+// suffixed metrics. The threshold margin is omitted when the threshold is 0,
+// since such attributes can never fail. Parts of packed raw values are
+// suffixed metrics too, e.g. raw_read_error_rate.errors on Seagate drives.
 func WithATASmartAttributes(entries ...string) Option {
 	const prefix = "ata_smart_attributes."
 	return func(c *Converter) {
 		c.extractors = append(c.extractors,
 			&extractorATASmartAttr{
 				metricPrefix: c.metricPrefix + prefix,
-				entries:      entries,
+				selectors:    parseATAAttributeSelectors(entries),
 			})
 	}
 }
@@ -61,9 +73,235 @@ func WithNVMeHealthInfo(entries ...string) Option {
 	}
 }
 
+// WithNVMeErrorInfoLog reports the selected NVMe error information log
+// entries: error_count, unread, entries and last_status_code.
+func WithNVMeErrorInfoLog(entries ...string) Option {
+	const prefix = "nvme_error_log."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorNVMeErrorInfoLog{
+				metricPrefix: c.metricPrefix + prefix,
+				entries:      entries,
+			})
+	}
+}
+
+// WithNVMeSelfTestLog reports the selected NVMe self-test log entries:
+// in_progress, completion_percent, failed_count, last_result, last_failed and
+// last_hours_ago.
+func WithNVMeSelfTestLog(entries ...string) Option {
+	const prefix = "nvme_self_test."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorNVMeSelfTestLog{
+				metricPrefix: c.metricPrefix + prefix,
+				entries:      entries,
+			})
+	}
+}
+
+// WithExitStatus reports the disk conditions flagged in the smartctl exit status.
+func WithExitStatus() Option {
+	const prefix = "exit_status."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorExitStatus{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithSmartctlVersion reports an info metric, always 1, tagged with the
+// version of smartctl which reported the device data.
+func WithSmartctlVersion() Option {
+	const name = "smartctl_version"
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSmartctlVersion{
+				name: c.metricPrefix + name,
+			})
+	}
+}
+
+// WithDeviceInfo reports the numeric device properties known for the device:
+// capacity and logical block size in bytes, rotation rate in RPM (0 for solid
+// state devices) and NVMe total capacity in bytes.
+func WithDeviceInfo() Option {
+	const prefix = "device."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorDeviceInfo{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithQueryStats reports how the smartctl query of the device went: the time
+// spent waiting for the query limiter, the wall time and the CPU time of
+// smartctl, in milliseconds.
+func WithQueryStats() Option {
+	const prefix = "query."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorQueryStats{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithATASelfTestLog reports the ATA SMART self-test log: the last result of
+// each test type and the number of failed tests.
+func WithATASelfTestLog() Option {
+	const prefix = "ata_self_test."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorATASelfTestLog{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithATAErrorLog reports the ATA SMART error count and how long ago the most
+// recent error happened, tagged with its error type.
+func WithATAErrorLog() Option {
+	const prefix = "ata_error_log."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorATAErrorLog{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithATASCTStatus reports the SCT temperatures: current, power cycle and
+// lifetime extremes, and the margins to the temperature limits.
+func WithATASCTStatus() Option {
+	const prefix = "ata_sct.temperature."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorATASCTStatus{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithATASCTTemperatureHistory reports the lowest and highest temperatures of
+// the SCT temperature history.
+func WithATASCTTemperatureHistory() Option {
+	const prefix = "ata_sct.temperature_history."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorATASCTTemperatureHistory{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithSATAPhyEventCounters reports the selected SATA Phy event counters. Entries
+// are counter IDs (e.g. "1") or normalized counter names (e.g.
+// "command_failed_due_to_icrc_error").
+func WithSATAPhyEventCounters(entries ...string) Option {
+	const prefix = "sata_phy."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSATAPhyEventCounters{
+				metricPrefix: c.metricPrefix + prefix,
+				entries:      strset.New(entries...),
+			})
+	}
+}
+
+// WithSCSIGrownDefectList reports the number of defects of the SCSI grown defect list.
+func WithSCSIGrownDefectList() Option {
+	const name = "scsi.grown_defect_list"
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSCSIGrownDefectList{
+				name: c.metricPrefix + name,
+			})
+	}
+}
+
+// WithSCSIErrorCounterLog reports the corrected and uncorrected errors of the
+// SCSI error counter log, tagged with the operation type (read, write, verify).
+func WithSCSIErrorCounterLog() Option {
+	const prefix = "scsi_error_counter_log."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSCSIErrorCounterLog{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithSCSIStartStopCycleCounter reports the accumulated start-stop and
+// load-unload cycles, along with their specified lifetime maximum.
+func WithSCSIStartStopCycleCounter() Option {
+	const prefix = "scsi_start_stop_cycle_counter."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSCSIStartStopCycleCounter{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithSCSIPercentageUsedEndurance reports the SCSI percentage used endurance
+// indicator of solid state drives.
+func WithSCSIPercentageUsedEndurance() Option {
+	const name = "scsi.percentage_used_endurance_indicator"
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSCSIPercentageUsedEndurance{
+				name: c.metricPrefix + name,
+			})
+	}
+}
+
+// WithSCSITemperature reports the current temperature of SCSI devices and its
+// margin to the drive trip temperature.
+func WithSCSITemperature() Option {
+	const prefix = "scsi.temperature."
+	return func(c *Converter) {
+		c.extractors = append(c.extractors,
+			&extractorSCSITemperature{
+				metricPrefix: c.metricPrefix + prefix,
+			})
+	}
+}
+
+// WithPowerMode reports the device power mode, when the device is queried
+// with a skip power mode: 1 for active, 2 for idle, 3 for standby and 4 for sleep.
+// It is the only metric reported for skipped devices, the other ones keeping
+// their latest value.
+func WithPowerMode() Option {
+	const name = "power_mode"
+	return func(c *Converter) {
+		e := &extractorPowerMode{
+			name: c.metricPrefix + name,
+		}
+		c.extractors = append(c.extractors, e)
+		c.powerMode = e
+	}
+}
+
+// WithHealth reports the SMART overall-health self-assessment result, both as
+// a metric and as a service check.
+func WithHealth() Option {
+	const name = "health"
+	return func(c *Converter) {
+		e := &extractorHealth{
+			name: c.metricPrefix + name,
+		}
+		c.extractors = append(c.extractors, e)
+		c.serviceChecks = append(c.serviceChecks, e)
+	}
+}
+
 func New(metricPrefix string, opts ...Option) *Converter {
 	c := &Converter{
 		metricPrefix: strings.Trim(metricPrefix, ".") + ".",
+		commonTags:   strset.New(),
 	}
 	for _, setOption := range opts {
 		setOption(c)
@@ -72,6 +310,9 @@ func New(metricPrefix string, opts ...Option) *Converter {
 }
 
 func (c *Converter) Convert(data smartctl.Data) metric.DeviceMetrics {
+	if data.Skipped {
+		return c.convertSkipped(data)
+	}
 	entries := make([]metric.Metric, 0, 64)
 	for _, extractor := range c.extractors {
 		entries = append(
@@ -79,8 +320,91 @@ func (c *Converter) Convert(data smartctl.Data) metric.DeviceMetrics {
 			extractor.Extract(data)...,
 		)
 	}
+	var serviceChecks []metric.ServiceCheck
+	for _, extractor := range c.serviceChecks {
+		serviceChecks = append(
+			serviceChecks,
+			extractor.ExtractServiceChecks(data)...,
+		)
+	}
+	return metric.DeviceMetrics{
+		DeviceName:    data.Device.Name,
+		DeviceID:      data.Device.ID(),
+		CommonTags:    c.extractTags(data),
+		Entries:       entries,
+		ServiceChecks: serviceChecks,
+	}
+}
+
+func (c *Converter) convertSkipped(data smartctl.Data) metric.DeviceMetrics {
+	var entries []metric.Metric
+	if c.powerMode != nil {
+		entries = c.powerMode.Extract(data)
+	}
 	return metric.DeviceMetrics{
 		DeviceName: data.Device.Name,
+		DeviceID:   data.Device.ID(),
+		Partial:    true,
+		CommonTags: c.extractTags(data),
+		Entries:    entries,
+	}
+}
+
+// ConvertEntries builds the metrics of a device out of entries computed by
+// another source, adding the metric prefix and the device tags.
+func (c *Converter) ConvertEntries(data smartctl.Data, source string, entries []metric.Metric) metric.DeviceMetrics {
+	prefixed := make([]metric.Metric, 0, len(entries))
+	for _, entry := range entries {
+		entry.Name = c.metricPrefix + entry.Name
+		prefixed = append(prefixed, entry)
+	}
+	return metric.DeviceMetrics{
+		DeviceName: data.Device.Name,
+		DeviceID:   data.Device.ID(),
+		Source:     source,
+		CommonTags: c.extractTags(data),
+		Entries:    prefixed,
+	}
+}
+
+// ConvertLimiterStats builds the metrics of the queries going through the
+// smartctl query limiter, not related to any device.
+func (c *Converter) ConvertLimiterStats(stats smartctl.LimiterStats) metric.DeviceMetrics {
+	return metric.DeviceMetrics{
+		Source: "query_limiter",
+		Entries: []metric.Metric{
+			{Name: c.metricPrefix + "query.in_flight", Value: stats.InFlight},
+			{Name: c.metricPrefix + "query.waiting", Value: stats.Waiting},
+		},
+	}
+}
+
+// ConvertQueryError builds the query error metrics of a device, for each error
+// class: 1 when the latest query failed with the class, 0 otherwise.
+func (c *Converter) ConvertQueryError(device smartctl.Device, err error) metric.DeviceMetrics {
+	failed := smartctl.ErrorClass(err)
+	classes := smartctl.ErrorClasses()
+	entries := make([]metric.Metric, 0, len(classes))
+	for _, class := range classes {
+		entries = append(entries, metric.Metric{
+			Name:  c.metricPrefix + "query.errors",
+			Value: boolToInt(class == failed),
+			Tags:  []string{"error_class:" + class},
+		})
+	}
+	controller, member := device.ControllerMember()
+	data := smartctl.Data{
+		Device: smartctl.DeviceInfo{
+			Name:             device.Path,
+			Type:             device.Type,
+			Controller:       controller,
+			ControllerMember: member,
+		},
+	}
+	return metric.DeviceMetrics{
+		DeviceName: device.Path,
+		DeviceID:   device.ID(),
+		Source:     "query_errors",
 		CommonTags: c.extractTags(data),
 		Entries:    entries,
 	}
@@ -89,7 +413,7 @@ func (c *Converter) Convert(data smartctl.Data) metric.DeviceMetrics {
 func (c *Converter) extractTags(data smartctl.Data) []string {
 	tags := make([]string, 0, c.commonTags.Size())
 
-	taggedDevice := deviceWithTags(data.Device)
+	taggedDevice := newDeviceWithTags(data.Device)
 	t := reflect.TypeOf(taggedDevice)
 	v := reflect.ValueOf(taggedDevice)
 	for idx := 0; idx < t.NumField(); idx++ {
@@ -98,11 +422,15 @@ func (c *Converter) extractTags(data smartctl.Data) []string {
 		if !c.commonTags.Has(tagName) {
 			continue
 		}
-		fieldValue := v.Field(idx).String()
+		// Commas separate tags in the statsd protocol, as in device type "sat+megaraid,0"
+		fieldValue := strings.ReplaceAll(v.Field(idx).String(), ",", "_")
 		if fieldValue != "" {
 			tags = append(tags, tagName+":"+fieldValue)
 		}
 	}
+	if c.commonTags.Has(smartctlVersionTag) && data.SmartctlVersion.Known() {
+		tags = append(tags, smartctlVersionTag+":"+data.SmartctlVersion.String())
+	}
 	return tags
 }
 
@@ -110,13 +438,44 @@ type metricsExtractor interface {
 	Extract(smartctl.Data) []metric.Metric
 }
 
+type serviceCheckExtractor interface {
+	ExtractServiceChecks(smartctl.Data) []metric.ServiceCheck
+}
+
 type extractorATASmartAttr struct {
 	metricPrefix string
-	entries      []string
+	selectors    []ataAttributeSelector
 }
 
 func (e extractorATASmartAttr) Extract(data smartctl.Data) []metric.Metric {
-	return extract(data.ATASmartAttributes, e.metricPrefix, e.entries)
+	attrs := selectATASmartAttributes(data.ATASmartAttributesTable, e.selectors)
+	out := make([]metric.Metric, 0, 5*len(attrs))
+	for _, attr := range attrs {
+		name := e.metricPrefix + strings.ToLower(attr.Name)
+		tags := attributeIDTags(attr)
+		out = append(out,
+			metric.Metric{Name: name, Value: attr.Decoded, Tags: tags},
+			metric.Metric{Name: name + ".value", Value: attr.Value, Tags: tags},
+			metric.Metric{Name: name + ".worst", Value: attr.Worst, Tags: tags},
+			metric.Metric{Name: name + ".thresh", Value: attr.Thresh, Tags: tags},
+		)
+		if attr.Thresh != 0 {
+			out = append(out, metric.Metric{Name: name + ".threshold_margin", Value: attr.ThresholdMargin(), Tags: tags})
+		}
+		parts := make([]string, 0, len(attr.Parts))
+		for part := range attr.Parts {
+			parts = append(parts, part)
+		}
+		sort.Strings(parts)
+		for _, part := range parts {
+			out = append(out, metric.Metric{Name: name + "." + part, Value: attr.Parts[part], Tags: tags})
+		}
+	}
+	return out
+}
+
+func attributeIDTags(attr smartctl.ATASmartAttribute) []string {
+	return []string{"attribute_id:" + strconv.Itoa(attr.ID)}
 }
 
 type extractorATADeviceStats struct {
@@ -137,6 +496,418 @@ func (e extractorNVMeHealthInfo) Extract(data smartctl.Data) []metric.Metric {
 	return extract(data.NVMeSmartHealthInfo, e.metricPrefix, e.entries)
 }
 
+type extractorNVMeErrorInfoLog struct {
+	metricPrefix string
+	entries      []string
+}
+
+func (e extractorNVMeErrorInfoLog) Extract(data smartctl.Data) []metric.Metric {
+	log := data.NVMeErrorInfoLog
+	if log == nil {
+		return nil
+	}
+
+	last, hasErrors := log.LastError()
+	available := map[string][]metric.Metric{
+		"error_count": {{Value: last.ErrorCount}},
+		"unread":      {{Value: log.Unread}},
+		"entries":     {{Value: len(log.Entries)}},
+	}
+	if hasErrors {
+		available["last_status_code"] = []metric.Metric{{
+			Value: last.StatusCode,
+			Tags: []string{
+				"status_code_type:" + strconv.Itoa(last.StatusCodeType),
+				"status:" + tagValue(last.Status),
+			},
+		}}
+	}
+	return selectEntries(available, e.metricPrefix, e.entries)
+}
+
+type extractorNVMeSelfTestLog struct {
+	metricPrefix string
+	entries      []string
+}
+
+func (e extractorNVMeSelfTestLog) Extract(data smartctl.Data) []metric.Metric {
+	log := data.NVMeSelfTestLog
+	if log == nil {
+		return nil
+	}
+
+	available := map[string][]metric.Metric{
+		"in_progress":  {{Value: boolToInt(log.InProgress())}},
+		"failed_count": {{Value: log.FailedCount()}},
+	}
+	if log.InProgress() {
+		available["completion_percent"] = []metric.Metric{{Value: log.CompletionPercent}}
+	}
+	for _, entry := range log.LastByType() {
+		tags := []string{"test_type:" + tagValue(entry.Type)}
+		available["last_result"] = append(available["last_result"], metric.Metric{Value: entry.Result, Tags: tags})
+		available["last_failed"] = append(available["last_failed"], metric.Metric{Value: boolToInt(entry.Failed()), Tags: tags})
+		if data.PowerOnHours > 0 {
+			available["last_hours_ago"] = append(available["last_hours_ago"], metric.Metric{
+				Value: data.PowerOnHours - entry.PowerOnHours,
+				Tags:  tags,
+			})
+		}
+	}
+	return selectEntries(available, e.metricPrefix, e.entries)
+}
+
+var exitStatusFlags = []struct {
+	flag smartctl.ExitStatus
+	name string
+}{
+	{smartctl.ExitSMARTCommandFailed, "smart_command_failed"},
+	{smartctl.ExitDiskFailing, "disk_failing"},
+	{smartctl.ExitPrefailBelowThreshold, "prefail_below_threshold"},
+	{smartctl.ExitBelowThresholdInPast, "below_threshold_in_past"},
+	{smartctl.ExitErrorLogHasErrors, "error_log_has_errors"},
+	{smartctl.ExitSelfTestLogHasErrors, "self_test_log_has_errors"},
+}
+
+type extractorExitStatus struct {
+	metricPrefix string
+}
+
+func (e extractorExitStatus) Extract(data smartctl.Data) []metric.Metric {
+	out := make([]metric.Metric, 0, len(exitStatusFlags))
+	for _, entry := range exitStatusFlags {
+		out = append(out, metric.Metric{
+			Name:  e.metricPrefix + entry.name,
+			Value: boolToInt(data.ExitStatus.Has(entry.flag)),
+		})
+	}
+	return out
+}
+
+type extractorSmartctlVersion struct {
+	name string
+}
+
+func (e extractorSmartctlVersion) Extract(data smartctl.Data) []metric.Metric {
+	if !data.SmartctlVersion.Known() {
+		return nil
+	}
+	return []metric.Metric{{
+		Name:  e.name,
+		Value: 1,
+		Tags:  []string{smartctlVersionTag + ":" + data.SmartctlVersion.String()},
+	}}
+}
+
+type extractorDeviceInfo struct {
+	metricPrefix string
+}
+
+func (e extractorDeviceInfo) Extract(data smartctl.Data) []metric.Metric {
+	info := data.Device
+	var out []metric.Metric
+	for _, entry := range []struct {
+		name  string
+		value int
+	}{
+		{"capacity_bytes", info.UserCapacity},
+		{"logical_block_size", info.LogicalBlockSize},
+		{"nvme_total_capacity_bytes", info.NVMeTotalCapacity},
+	} {
+		if entry.value > 0 {
+			out = append(out, metric.Metric{Name: e.metricPrefix + entry.name, Value: entry.value})
+		}
+	}
+	if info.RotationRate != nil {
+		out = append(out, metric.Metric{Name: e.metricPrefix + "rotation_rate", Value: *info.RotationRate})
+	}
+	return out
+}
+
+type extractorQueryStats struct {
+	metricPrefix string
+}
+
+func (e extractorQueryStats) Extract(data smartctl.Data) []metric.Metric {
+	invocation := data.Invocation
+	return []metric.Metric{
+		{Name: e.metricPrefix + "queue_wait_ms", Value: int(invocation.QueueWait / time.Millisecond)},
+		{Name: e.metricPrefix + "wall_time_ms", Value: int(invocation.WallTime / time.Millisecond)},
+		{Name: e.metricPrefix + "cpu_time_ms", Value: int(invocation.CPUTime / time.Millisecond)},
+	}
+}
+
+type extractorATASelfTestLog struct {
+	metricPrefix string
+}
+
+func (e extractorATASelfTestLog) Extract(data smartctl.Data) []metric.Metric {
+	log := data.ATASelfTestLog
+	if log == nil {
+		return nil
+	}
+
+	out := []metric.Metric{{
+		Name:  e.metricPrefix + "failed_count",
+		Value: log.ErrorCountTotal,
+	}}
+	for _, entry := range log.LastByType() {
+		tags := []string{"test_type:" + tagValue(entry.Type)}
+		out = append(out,
+			metric.Metric{Name: e.metricPrefix + "last.status", Value: entry.StatusCode(), Tags: tags},
+			metric.Metric{Name: e.metricPrefix + "last.failed", Value: boolToInt(entry.Failed), Tags: tags},
+			metric.Metric{Name: e.metricPrefix + "last.lifetime_hours", Value: entry.LifetimeHours, Tags: tags},
+		)
+		if data.PowerOnHours > 0 {
+			// Self-test log timestamps are 16 bits wide and wrap around
+			out = append(out, metric.Metric{
+				Name:  e.metricPrefix + "last.hours_ago",
+				Value: (data.PowerOnHours - entry.LifetimeHours) & 0xffff,
+				Tags:  tags,
+			})
+		}
+	}
+	if entry, ok := log.LastFailed(); ok {
+		out = append(out, metric.Metric{
+			Name:  e.metricPrefix + "first_error_lba",
+			Value: entry.LBA,
+			Tags:  []string{"test_type:" + tagValue(entry.Type)},
+		})
+	}
+	return out
+}
+
+type extractorATAErrorLog struct {
+	metricPrefix string
+}
+
+func (e extractorATAErrorLog) Extract(data smartctl.Data) []metric.Metric {
+	log := data.ATAErrorLog
+	if log == nil {
+		return nil
+	}
+
+	out := []metric.Metric{{
+		Name:  e.metricPrefix + "count",
+		Value: log.Count,
+	}}
+	if len(log.Entries) > 0 && data.PowerOnHours > 0 {
+		last := log.Entries[0]
+		// Error log timestamps are 16 bits wide and wrap around
+		out = append(out, metric.Metric{
+			Name:  e.metricPrefix + "last_error.hours_ago",
+			Value: (data.PowerOnHours - last.LifetimeHours) & 0xffff,
+			Tags:  []string{"error_type:" + tagValue(strings.Join(last.ErrorTypes(), "_"))},
+		})
+	}
+	return out
+}
+
+type extractorATASCTStatus struct {
+	metricPrefix string
+}
+
+func (e extractorATASCTStatus) Extract(data smartctl.Data) []metric.Metric {
+	status := data.ATASCTStatus
+	if status == nil {
+		return nil
+	}
+
+	out := []metric.Metric{
+		{Name: e.metricPrefix + "current", Value: status.Current},
+		{Name: e.metricPrefix + "power_cycle_min", Value: status.PowerCycleMin},
+		{Name: e.metricPrefix + "power_cycle_max", Value: status.PowerCycleMax},
+		{Name: e.metricPrefix + "lifetime_min", Value: status.LifetimeMin},
+		{Name: e.metricPrefix + "lifetime_max", Value: status.LifetimeMax},
+		{Name: e.metricPrefix + "under_limit_count", Value: status.UnderLimitCount},
+		{Name: e.metricPrefix + "over_limit_count", Value: status.OverLimitCount},
+	}
+	if limits := status.TemperatureLimit; limits.Known() {
+		out = append(out,
+			metric.Metric{Name: e.metricPrefix + "op_limit_max_margin", Value: limits.OpLimitMax - status.Current},
+			metric.Metric{Name: e.metricPrefix + "op_limit_min_margin", Value: status.Current - limits.OpLimitMin},
+			metric.Metric{Name: e.metricPrefix + "limit_max_margin", Value: limits.LimitMax - status.Current},
+			metric.Metric{Name: e.metricPrefix + "limit_min_margin", Value: status.Current - limits.LimitMin},
+		)
+	}
+	return out
+}
+
+type extractorATASCTTemperatureHistory struct {
+	metricPrefix string
+}
+
+func (e extractorATASCTTemperatureHistory) Extract(data smartctl.Data) []metric.Metric {
+	if data.ATASCTTemperatureHistory == nil {
+		return nil
+	}
+	min, max, ok := data.ATASCTTemperatureHistory.MinMax()
+	if !ok {
+		return nil
+	}
+	return []metric.Metric{
+		{Name: e.metricPrefix + "min", Value: min},
+		{Name: e.metricPrefix + "max", Value: max},
+	}
+}
+
+type extractorSATAPhyEventCounters struct {
+	metricPrefix string
+	entries      *strset.Set
+}
+
+func (e extractorSATAPhyEventCounters) Extract(data smartctl.Data) []metric.Metric {
+	out := make([]metric.Metric, 0, 2*e.entries.Size())
+	for _, counter := range data.SATAPhyEventCounters {
+		id := strconv.Itoa(counter.ID)
+		name := metricName(counter.Name)
+		if !e.entries.Has(id) && !e.entries.Has(name) {
+			continue
+		}
+		tags := []string{"counter_id:" + id}
+		out = append(out,
+			metric.Metric{Name: e.metricPrefix + name, Value: counter.Value, Tags: tags},
+			metric.Metric{Name: e.metricPrefix + name + ".overflow", Value: boolToInt(counter.Overflow), Tags: tags},
+		)
+	}
+	return out
+}
+
+type extractorSCSIGrownDefectList struct {
+	name string
+}
+
+func (e extractorSCSIGrownDefectList) Extract(data smartctl.Data) []metric.Metric {
+	if data.SCSIGrownDefectList == nil {
+		return nil
+	}
+	return []metric.Metric{{Name: e.name, Value: *data.SCSIGrownDefectList}}
+}
+
+type extractorSCSIErrorCounterLog struct {
+	metricPrefix string
+}
+
+func (e extractorSCSIErrorCounterLog) Extract(data smartctl.Data) []metric.Metric {
+	log := data.SCSIErrorCounterLog
+	if log == nil {
+		return nil
+	}
+
+	var out []metric.Metric
+	for _, op := range []struct {
+		name     string
+		counters *smartctl.SCSIErrorCounters
+	}{
+		{"read", log.Read},
+		{"write", log.Write},
+		{"verify", log.Verify},
+	} {
+		if op.counters == nil {
+			continue
+		}
+		tags := []string{"operation:" + op.name}
+		out = append(out,
+			metric.Metric{Name: e.metricPrefix + "corrected", Value: op.counters.TotalCorrected, Tags: tags},
+			metric.Metric{Name: e.metricPrefix + "uncorrected", Value: op.counters.TotalUncorrected, Tags: tags},
+			metric.Metric{Name: e.metricPrefix + "correction_algorithm_invocations", Value: op.counters.CorrectionAlgorithmInvocations, Tags: tags},
+			metric.Metric{Name: e.metricPrefix + "gigabytes_processed", Value: int(op.counters.GigabytesProcessed), Tags: tags},
+		)
+	}
+	return out
+}
+
+type extractorSCSIStartStopCycleCounter struct {
+	metricPrefix string
+}
+
+func (e extractorSCSIStartStopCycleCounter) Extract(data smartctl.Data) []metric.Metric {
+	counter := data.SCSIStartStopCycleCounter
+	if counter == nil {
+		return nil
+	}
+	return []metric.Metric{
+		{Name: e.metricPrefix + "start_stop_cycles", Value: counter.AccumulatedStartStopCycles},
+		{Name: e.metricPrefix + "specified_start_stop_cycles", Value: counter.SpecifiedCycleCount},
+		{Name: e.metricPrefix + "load_unload_cycles", Value: counter.AccumulatedLoadUnloadCycles},
+		{Name: e.metricPrefix + "specified_load_unload_cycles", Value: counter.SpecifiedLoadUnloadCount},
+	}
+}
+
+type extractorSCSIPercentageUsedEndurance struct {
+	name string
+}
+
+func (e extractorSCSIPercentageUsedEndurance) Extract(data smartctl.Data) []metric.Metric {
+	if data.SCSIPercentageUsedEndurance == nil {
+		return nil
+	}
+	return []metric.Metric{{Name: e.name, Value: *data.SCSIPercentageUsedEndurance}}
+}
+
+type extractorSCSITemperature struct {
+	metricPrefix string
+}
+
+func (e extractorSCSITemperature) Extract(data smartctl.Data) []metric.Metric {
+	temp := data.SCSITemperature
+	if temp == nil {
+		return nil
+	}
+	out := []metric.Metric{{Name: e.metricPrefix + "current", Value: temp.Current}}
+	if temp.DriveTrip > 0 {
+		out = append(out, metric.Metric{Name: e.metricPrefix + "drive_trip_margin", Value: temp.DriveTrip - temp.Current})
+	}
+	return out
+}
+
+type extractorPowerMode struct {
+	name string
+}
+
+func (e extractorPowerMode) Extract(data smartctl.Data) []metric.Metric {
+	if data.PowerMode == smartctl.PowerModeUnknown {
+		return nil
+	}
+	return []metric.Metric{{Name: e.name, Value: int(data.PowerMode)}}
+}
+
+type extractorHealth struct {
+	name string
+}
+
+func (e extractorHealth) Extract(data smartctl.Data) []metric.Metric {
+	if data.Health == smartctl.HealthUnknown {
+		return nil
+	}
+	return []metric.Metric{{
+		Name:  e.name + ".passed",
+		Value: boolToInt(data.Health == smartctl.HealthPassed),
+	}}
+}
+
+func (e extractorHealth) ExtractServiceChecks(data smartctl.Data) []metric.ServiceCheck {
+	check := metric.ServiceCheck{Name: e.name}
+	switch data.Health {
+	case smartctl.HealthPassed:
+		check.Status = metric.ServiceCheckOK
+	case smartctl.HealthFailed:
+		check.Status = metric.ServiceCheckCritical
+		check.Message = "SMART overall-health self-assessment test failed"
+	default:
+		check.Status = metric.ServiceCheckUnknown
+		check.Message = "SMART overall-health self-assessment result is not available"
+	}
+	return []metric.ServiceCheck{check}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func extract(data map[string]int, metricPrefix string, entries []string) []metric.Metric {
 	out := make([]metric.Metric, 0, len(entries))
 	for _, entry := range entries {
@@ -151,3 +922,15 @@ func extract(data map[string]int, metricPrefix string, entries []string) []metri
 	}
 	return out
 }
+
+// selectEntries returns the metrics of the selected entries, named after the entry.
+func selectEntries(available map[string][]metric.Metric, metricPrefix string, entries []string) []metric.Metric {
+	out := make([]metric.Metric, 0, len(entries))
+	for _, entry := range entries {
+		for _, m := range available[entry] {
+			m.Name = metricPrefix + entry
+			out = append(out, m)
+		}
+	}
+	return out
+}
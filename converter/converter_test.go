@@ -1,7 +1,11 @@
 package converter
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -54,24 +58,10 @@ func TestConverter(t *testing.T) {
 				"time in over-temperature":                     0,
 				"time in under-temperature":                    0,
 			},
-			ATASmartAttributes: map[string]int{
-				"current_pending_sector":  0,
-				"load_cycle_count":        333,
-				"offline_uncorrectable":   0,
-				"power-off_retract_count": 333,
-				"power_cycle_count":       17,
-				"power_on_hours":          7598,
-				"raw_read_error_rate":     0,
-				"reallocated_event_count": 0,
-				"reallocated_sector_ct":   0,
-				"seek_error_rate":         0,
-				"seek_time_performance":   18,
-				"spin_retry_count":        0,
-				"spin_up_time":            34374156674,
-				"start_stop_count":        17,
-				"temperature_celsius":     37,
-				"throughput_performance":  96,
-				"udma_crc_error_count":    0,
+			ATASmartAttributesTable: []smartctl.ATASmartAttribute{
+				{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Thresh: 16, Flags: 11, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 9, Name: "Power_On_Hours", Value: 99, Worst: 99, Thresh: 0, Flags: 18, Raw: 7598, RawString: "7598", Decoded: 7598},
+				{ID: 194, Name: "Temperature_Celsius", Value: 110, Worst: 100, Thresh: 0, Flags: 34, Raw: 193274920997, RawString: "37 (Min/Max 16/45)", Decoded: 37},
 			},
 		}
 		converter := New(
@@ -88,9 +78,16 @@ func TestConverter(t *testing.T) {
 			"device_protocol:" + data.Device.Protocol,
 		}, metrics.CommonTags)
 		require.ElementsMatch(t, []metric.Metric{
-			{"foo.bar.ata_smart_attributes.temperature_celsius", 37},
-			{"foo.bar.ata_smart_attributes.raw_read_error_rate", 0},
-			{"foo.bar.ata_device_stats.logical sectors read", 76849055332},
+			{Name: "foo.bar.ata_smart_attributes.temperature_celsius", Value: 37, Tags: []string{"attribute_id:194"}},
+			{Name: "foo.bar.ata_smart_attributes.temperature_celsius.value", Value: 110, Tags: []string{"attribute_id:194"}},
+			{Name: "foo.bar.ata_smart_attributes.temperature_celsius.worst", Value: 100, Tags: []string{"attribute_id:194"}},
+			{Name: "foo.bar.ata_smart_attributes.temperature_celsius.thresh", Value: 0, Tags: []string{"attribute_id:194"}},
+			{Name: "foo.bar.ata_smart_attributes.raw_read_error_rate", Value: 0, Tags: []string{"attribute_id:1"}},
+			{Name: "foo.bar.ata_smart_attributes.raw_read_error_rate.value", Value: 100, Tags: []string{"attribute_id:1"}},
+			{Name: "foo.bar.ata_smart_attributes.raw_read_error_rate.worst", Value: 100, Tags: []string{"attribute_id:1"}},
+			{Name: "foo.bar.ata_smart_attributes.raw_read_error_rate.thresh", Value: 16, Tags: []string{"attribute_id:1"}},
+			{Name: "foo.bar.ata_smart_attributes.raw_read_error_rate.threshold_margin", Value: 84, Tags: []string{"attribute_id:1"}},
+			{Name: "foo.bar.ata_device_stats.logical sectors read", Value: 76849055332},
 		}, metrics.Entries)
 	})
 
@@ -148,9 +145,505 @@ func TestConverter(t *testing.T) {
 			"device_protocol:" + data.Device.Protocol,
 		}, metrics.CommonTags)
 		require.ElementsMatch(t, []metric.Metric{
-			{"test.nvme_health.temperature", 35},
-			{"test.nvme_health.available_spare", 100},
+			{Name: "test.nvme_health.temperature", Value: 35},
+			{Name: "test.nvme_health.available_spare", Value: 100},
 		}, metrics.Entries)
 
 	})
+
+	t.Run("should report exit status flags", func(t *testing.T) {
+		data := smartctl.Data{
+			Device:     smartctl.DeviceInfo{Name: "/dev/sda"},
+			ExitStatus: smartctl.ExitDiskFailing | smartctl.ExitSelfTestLogHasErrors,
+		}
+
+		converter := New("test", WithExitStatus())
+		metrics := converter.Convert(data)
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.exit_status.smart_command_failed", Value: 0},
+			{Name: "test.exit_status.disk_failing", Value: 1},
+			{Name: "test.exit_status.prefail_below_threshold", Value: 0},
+			{Name: "test.exit_status.below_threshold_in_past", Value: 0},
+			{Name: "test.exit_status.error_log_has_errors", Value: 0},
+			{Name: "test.exit_status.self_test_log_has_errors", Value: 1},
+		}, metrics.Entries)
+	})
+
+	t.Run("should report normalized values of ATA SMART attributes", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sdc"},
+			ATASmartAttributesTable: []smartctl.ATASmartAttribute{
+				{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Thresh: 16, Flags: 11, Raw: 0, RawString: "0"},
+				{ID: 7, Name: "Seek_Error_Rate", Value: 90, Worst: 60, Thresh: 30, Raw: 2<<32 | 1000, Decoded: 2<<32 | 1000, Parts: map[string]int{"operations": 1000, "errors": 2}},
+				{ID: 5, Name: "Reallocated_Sector_Ct", Value: 95, Worst: 90, Thresh: 5, Flags: 51, Raw: 112, RawString: "112", Decoded: 112},
+				{ID: 9, Name: "Power_On_Hours", Value: 99, Worst: 99, Thresh: 0, Flags: 18, Raw: 7598, RawString: "7598", Decoded: 7598},
+			},
+		}
+
+		// No threshold margin for attributes which can never fail
+		converter := New("test", WithATASmartAttributes("reallocated_sector_ct", "power_on_hours", "seek_error_rate", "unknown"))
+		metrics := converter.Convert(data)
+		reallocated := []string{"attribute_id:5"}
+		powerOn := []string{"attribute_id:9"}
+		seek := []string{"attribute_id:7"}
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct", Value: 112, Tags: reallocated},
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct.value", Value: 95, Tags: reallocated},
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct.worst", Value: 90, Tags: reallocated},
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct.thresh", Value: 5, Tags: reallocated},
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct.threshold_margin", Value: 90, Tags: reallocated},
+			{Name: "test.ata_smart_attributes.seek_error_rate", Value: 2<<32 | 1000, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.value", Value: 90, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.worst", Value: 60, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.thresh", Value: 30, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.threshold_margin", Value: 60, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.errors", Value: 2, Tags: seek},
+			{Name: "test.ata_smart_attributes.seek_error_rate.operations", Value: 1000, Tags: seek},
+			{Name: "test.ata_smart_attributes.power_on_hours", Value: 7598, Tags: powerOn},
+			{Name: "test.ata_smart_attributes.power_on_hours.value", Value: 99, Tags: powerOn},
+			{Name: "test.ata_smart_attributes.power_on_hours.worst", Value: 99, Tags: powerOn},
+			{Name: "test.ata_smart_attributes.power_on_hours.thresh", Value: 0, Tags: powerOn},
+		}, metrics.Entries)
+	})
+
+	t.Run("should select ATA SMART attributes by ID", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sdc"},
+			ATASmartAttributesTable: []smartctl.ATASmartAttribute{
+				{ID: 5, Name: "Reallocated_Sector_Ct", Value: 95, Worst: 90, Thresh: 5, Raw: 112, Decoded: 112},
+				{ID: 170, Name: "Unknown_Attribute", Value: 100, Worst: 100, Thresh: 10, Raw: 3, Decoded: 3},
+				{ID: 171, Name: "Unknown_Attribute", Value: 100, Worst: 100, Thresh: 0, Raw: 7, Decoded: 7},
+				{ID: 194, Name: "Temperature_Celsius", Value: 110, Worst: 100, Thresh: 0, Raw: 193274920997, Decoded: 37},
+			},
+		}
+
+		converter := New("test", WithATASmartAttributes("id:194", "5", "unknown_attribute", "reallocated_sector_ct"))
+		// Decoded raw values only, normalized values are checked above
+		var decoded []metric.Metric
+		for _, m := range converter.Convert(data).Entries {
+			if strings.Count(m.Name, ".") == 2 {
+				decoded = append(decoded, m)
+			}
+		}
+		require.Equal(t, []metric.Metric{
+			{Name: "test.ata_smart_attributes.temperature_celsius", Value: 37, Tags: []string{"attribute_id:194"}},
+			{Name: "test.ata_smart_attributes.reallocated_sector_ct", Value: 112, Tags: []string{"attribute_id:5"}},
+			{Name: "test.ata_smart_attributes.unknown_attribute", Value: 3, Tags: []string{"attribute_id:170"}},
+			{Name: "test.ata_smart_attributes.unknown_attribute", Value: 7, Tags: []string{"attribute_id:171"}},
+		}, decoded)
+
+		require.Empty(t, InvalidATAAttributeSelectors([]string{"id:5", "5", "temperature_celsius"}))
+		require.Len(t, InvalidATAAttributeSelectors([]string{"id:abc", "0", "id:256"}), 3)
+	})
+
+	t.Run("should report health status", func(t *testing.T) {
+		converter := New("test", WithTags("device_name"), WithHealth())
+
+		metrics := converter.Convert(smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sda"},
+			Health: smartctl.HealthPassed,
+		})
+		require.Equal(t, []string{"device_name:/dev/sda"}, metrics.CommonTags)
+		require.Equal(t, []metric.Metric{{Name: "test.health.passed", Value: 1}}, metrics.Entries)
+		require.Equal(t, []metric.ServiceCheck{{Name: "test.health", Status: metric.ServiceCheckOK}}, metrics.ServiceChecks)
+
+		metrics = converter.Convert(smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sda"},
+			Health: smartctl.HealthFailed,
+		})
+		require.Equal(t, []metric.Metric{{Name: "test.health.passed", Value: 0}}, metrics.Entries)
+		require.Len(t, metrics.ServiceChecks, 1)
+		require.Equal(t, metric.ServiceCheckCritical, metrics.ServiceChecks[0].Status)
+
+		metrics = converter.Convert(smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sda"},
+		})
+		require.Empty(t, metrics.Entries)
+		require.Len(t, metrics.ServiceChecks, 1)
+		require.Equal(t, metric.ServiceCheckUnknown, metrics.ServiceChecks[0].Status)
+	})
+
+	t.Run("should report ATA self-test log", func(t *testing.T) {
+		data := smartctl.Data{
+			Device:       smartctl.DeviceInfo{Name: "/dev/sda"},
+			PowerOnHours: 130,
+			ATASelfTestLog: &smartctl.ATASelfTestLog{
+				Count:           3,
+				ErrorCountTotal: 1,
+				Entries: []smartctl.ATASelfTestEntry{
+					{Type: "Short offline", Status: 0, LifetimeHours: 120},
+					{Type: "Extended offline", Status: 0x79, Failed: true, LifetimeHours: 100, LBA: 123456},
+					{Type: "Short offline", Status: 0, LifetimeHours: 96},
+				},
+			},
+		}
+
+		converter := New("test", WithATASelfTestLog())
+		metrics := converter.Convert(data)
+		short := []string{"test_type:short_offline"}
+		extended := []string{"test_type:extended_offline"}
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.ata_self_test.failed_count", Value: 1},
+			{Name: "test.ata_self_test.last.status", Value: 0, Tags: short},
+			{Name: "test.ata_self_test.last.failed", Value: 0, Tags: short},
+			{Name: "test.ata_self_test.last.lifetime_hours", Value: 120, Tags: short},
+			{Name: "test.ata_self_test.last.hours_ago", Value: 10, Tags: short},
+			{Name: "test.ata_self_test.last.status", Value: 7, Tags: extended},
+			{Name: "test.ata_self_test.last.failed", Value: 1, Tags: extended},
+			{Name: "test.ata_self_test.last.lifetime_hours", Value: 100, Tags: extended},
+			{Name: "test.ata_self_test.last.hours_ago", Value: 30, Tags: extended},
+			{Name: "test.ata_self_test.first_error_lba", Value: 123456, Tags: extended},
+		}, metrics.Entries)
+
+		require.Empty(t, converter.Convert(smartctl.Data{}).Entries)
+	})
+
+	t.Run("should convert entries from other sources", func(t *testing.T) {
+		converter := New("test", WithTags("device_name"))
+		metrics := converter.ConvertEntries(
+			smartctl.Data{Device: smartctl.DeviceInfo{Name: "/dev/sda"}},
+			"self_test",
+			[]metric.Metric{{Name: "self_test.in_progress", Value: 1}},
+		)
+		require.Equal(t, metric.DeviceMetrics{
+			DeviceName: "/dev/sda",
+			DeviceID:   "/dev/sda",
+			Source:     "self_test",
+			CommonTags: []string{"device_name:/dev/sda"},
+			Entries:    []metric.Metric{{Name: "test.self_test.in_progress", Value: 1}},
+		}, metrics)
+	})
+
+	t.Run("should report ATA error log", func(t *testing.T) {
+		data := smartctl.Data{
+			Device:       smartctl.DeviceInfo{Name: "/dev/sda"},
+			PowerOnHours: 7600,
+			ATAErrorLog: &smartctl.ATAErrorLog{
+				Count: 12,
+				Entries: []smartctl.ATAErrorEntry{
+					{ErrorNumber: 12, LifetimeHours: 7590, Description: "Error: ICRC, ABRT 8 sectors at LBA = 0x00a3f1c8 = 10744264"},
+					{ErrorNumber: 11, LifetimeHours: 7012, Description: "Error: UNC at LBA = 0x0001e240 = 123456"},
+				},
+			},
+		}
+
+		converter := New("test", WithATAErrorLog())
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.ata_error_log.count", Value: 12},
+			{Name: "test.ata_error_log.last_error.hours_ago", Value: 10, Tags: []string{"error_type:icrc_abrt"}},
+		}, converter.Convert(data).Entries)
+
+		data.ATAErrorLog = &smartctl.ATAErrorLog{}
+		require.Equal(t, []metric.Metric{
+			{Name: "test.ata_error_log.count", Value: 0},
+		}, converter.Convert(data).Entries)
+	})
+
+	t.Run("should report ATA SCT temperatures", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sdc"},
+			ATASCTStatus: &smartctl.ATASCTStatus{
+				DeviceState:   "Active",
+				Current:       37,
+				PowerCycleMin: 17,
+				PowerCycleMax: 39,
+				LifetimeMin:   16,
+				LifetimeMax:   45,
+				TemperatureLimit: smartctl.TemperatureLimits{
+					OpLimitMin: 0,
+					OpLimitMax: 60,
+					LimitMin:   -40,
+					LimitMax:   70,
+				},
+			},
+			ATASCTTemperatureHistory: &smartctl.ATASCTTemperatureHistory{
+				Samples: []int{35, 41, 38, 37},
+			},
+		}
+
+		converter := New("test", WithATASCTStatus(), WithATASCTTemperatureHistory())
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.ata_sct.temperature.current", Value: 37},
+			{Name: "test.ata_sct.temperature.power_cycle_min", Value: 17},
+			{Name: "test.ata_sct.temperature.power_cycle_max", Value: 39},
+			{Name: "test.ata_sct.temperature.lifetime_min", Value: 16},
+			{Name: "test.ata_sct.temperature.lifetime_max", Value: 45},
+			{Name: "test.ata_sct.temperature.under_limit_count", Value: 0},
+			{Name: "test.ata_sct.temperature.over_limit_count", Value: 0},
+			{Name: "test.ata_sct.temperature.op_limit_max_margin", Value: 23},
+			{Name: "test.ata_sct.temperature.op_limit_min_margin", Value: 37},
+			{Name: "test.ata_sct.temperature.limit_max_margin", Value: 33},
+			{Name: "test.ata_sct.temperature.limit_min_margin", Value: 77},
+			{Name: "test.ata_sct.temperature_history.min", Value: 35},
+			{Name: "test.ata_sct.temperature_history.max", Value: 41},
+		}, converter.Convert(data).Entries)
+	})
+
+	t.Run("should report SATA Phy event counters", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sdc"},
+			SATAPhyEventCounters: []smartctl.SATAPhyEventCounter{
+				{ID: 1, Name: "Command failed due to ICRC error", Size: 2, Value: 65535, Overflow: true},
+				{ID: 2, Name: "R_ERR response for data FIS", Size: 2, Value: 3},
+				{ID: 10, Name: "Device-to-host register FISes sent due to a COMRESET", Size: 2, Value: 3},
+			},
+		}
+
+		converter := New("test", WithSATAPhyEventCounters("1", "r_err_response_for_data_fis"))
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "test.sata_phy.command_failed_due_to_icrc_error", Value: 65535, Tags: []string{"counter_id:1"}},
+			{Name: "test.sata_phy.command_failed_due_to_icrc_error.overflow", Value: 1, Tags: []string{"counter_id:1"}},
+			{Name: "test.sata_phy.r_err_response_for_data_fis", Value: 3, Tags: []string{"counter_id:2"}},
+			{Name: "test.sata_phy.r_err_response_for_data_fis.overflow", Value: 0, Tags: []string{"counter_id:2"}},
+		}, converter.Convert(data).Entries)
+	})
+
+	t.Run("should report NVMe error information log", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/nvme0n1"},
+			NVMeErrorInfoLog: &smartctl.NVMeErrorInfoLog{
+				Size: 256,
+				Read: 16,
+				Entries: []smartctl.NVMeErrorInfoEntry{
+					{ErrorCount: 2, StatusCode: 2, Status: "Invalid Field in Command"},
+					{ErrorCount: 3, StatusCodeType: 2, StatusCode: 129, Status: "Unrecovered Read Error"},
+				},
+			},
+		}
+
+		converter := New("test", WithNVMeErrorInfoLog("error_count", "last_status_code", "unknown"))
+		require.Equal(t, []metric.Metric{
+			{Name: "test.nvme_error_log.error_count", Value: 3},
+			{Name: "test.nvme_error_log.last_status_code", Value: 129, Tags: []string{"status_code_type:2", "status:unrecovered_read_error"}},
+		}, converter.Convert(data).Entries)
+
+		require.Empty(t, converter.Convert(smartctl.Data{}).Entries)
+	})
+
+	t.Run("should report NVMe self-test log", func(t *testing.T) {
+		data := smartctl.Data{
+			Device:       smartctl.DeviceInfo{Name: "/dev/nvme0n1"},
+			PowerOnHours: 7146,
+			NVMeSelfTestLog: &smartctl.NVMeSelfTestLog{
+				CurrentOperation:  1,
+				CompletionPercent: 30,
+				Entries: []smartctl.NVMeSelfTestEntry{
+					{Code: 1, Type: "Short", PowerOnHours: 7140},
+					{Code: 2, Type: "Extended", Result: 7, PowerOnHours: 7012},
+					{Code: 1, Type: "Short", PowerOnHours: 7000},
+				},
+			},
+		}
+
+		converter := New("test", WithNVMeSelfTestLog("in_progress", "completion_percent", "failed_count", "last_failed", "last_hours_ago"))
+		require.Equal(t, []metric.Metric{
+			{Name: "test.nvme_self_test.in_progress", Value: 1},
+			{Name: "test.nvme_self_test.completion_percent", Value: 30},
+			{Name: "test.nvme_self_test.failed_count", Value: 1},
+			{Name: "test.nvme_self_test.last_failed", Value: 0, Tags: []string{"test_type:short"}},
+			{Name: "test.nvme_self_test.last_failed", Value: 1, Tags: []string{"test_type:extended"}},
+			{Name: "test.nvme_self_test.last_hours_ago", Value: 6, Tags: []string{"test_type:short"}},
+			{Name: "test.nvme_self_test.last_hours_ago", Value: 134, Tags: []string{"test_type:extended"}},
+		}, converter.Convert(data).Entries)
+	})
+
+	t.Run("should report SCSI data", func(t *testing.T) {
+		grownDefects, endurance := 8, 3
+		data := smartctl.Data{
+			Device:              smartctl.DeviceInfo{Name: "/dev/sdd"},
+			SCSIGrownDefectList: &grownDefects,
+			SCSIErrorCounterLog: &smartctl.SCSIErrorCounterLog{
+				Read:   &smartctl.SCSIErrorCounters{TotalCorrected: 12, GigabytesProcessed: 451387.112},
+				Verify: &smartctl.SCSIErrorCounters{TotalCorrected: 1035, TotalUncorrected: 1, GigabytesProcessed: 3.271},
+			},
+			SCSIStartStopCycleCounter: &smartctl.SCSIStartStopCycleCounter{
+				SpecifiedCycleCount:         10000,
+				AccumulatedStartStopCycles:  105,
+				SpecifiedLoadUnloadCount:    300000,
+				AccumulatedLoadUnloadCycles: 1570,
+			},
+			SCSIPercentageUsedEndurance: &endurance,
+			SCSITemperature:             &smartctl.Temperature{Current: 31, DriveTrip: 68},
+		}
+
+		converter := New("test",
+			WithSCSIGrownDefectList(),
+			WithSCSIErrorCounterLog(),
+			WithSCSIStartStopCycleCounter(),
+			WithSCSIPercentageUsedEndurance(),
+			WithSCSITemperature(),
+		)
+		require.Equal(t, []metric.Metric{
+			{Name: "test.scsi.grown_defect_list", Value: 8},
+			{Name: "test.scsi_error_counter_log.corrected", Value: 12, Tags: []string{"operation:read"}},
+			{Name: "test.scsi_error_counter_log.uncorrected", Value: 0, Tags: []string{"operation:read"}},
+			{Name: "test.scsi_error_counter_log.correction_algorithm_invocations", Value: 0, Tags: []string{"operation:read"}},
+			{Name: "test.scsi_error_counter_log.gigabytes_processed", Value: 451387, Tags: []string{"operation:read"}},
+			{Name: "test.scsi_error_counter_log.corrected", Value: 1035, Tags: []string{"operation:verify"}},
+			{Name: "test.scsi_error_counter_log.uncorrected", Value: 1, Tags: []string{"operation:verify"}},
+			{Name: "test.scsi_error_counter_log.correction_algorithm_invocations", Value: 0, Tags: []string{"operation:verify"}},
+			{Name: "test.scsi_error_counter_log.gigabytes_processed", Value: 3, Tags: []string{"operation:verify"}},
+			{Name: "test.scsi_start_stop_cycle_counter.start_stop_cycles", Value: 105},
+			{Name: "test.scsi_start_stop_cycle_counter.specified_start_stop_cycles", Value: 10000},
+			{Name: "test.scsi_start_stop_cycle_counter.load_unload_cycles", Value: 1570},
+			{Name: "test.scsi_start_stop_cycle_counter.specified_load_unload_cycles", Value: 300000},
+			{Name: "test.scsi.percentage_used_endurance_indicator", Value: 3},
+			{Name: "test.scsi.temperature.current", Value: 31},
+			{Name: "test.scsi.temperature.drive_trip_margin", Value: 37},
+		}, converter.Convert(data).Entries)
+
+		require.Empty(t, converter.Convert(smartctl.Data{}).Entries)
+	})
+
+	t.Run("should tell apart RAID controller members", func(t *testing.T) {
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{
+				Name:             "/dev/bus/0",
+				Type:             "sat+megaraid,1",
+				Controller:       "megaraid",
+				ControllerMember: "1",
+			},
+		}
+		converter := New("test", WithTags("device_name", "device_type", "controller", "controller_member"))
+		metrics := converter.Convert(data)
+		require.Equal(t, "/dev/bus/0:megaraid,1", metrics.DeviceID)
+		require.ElementsMatch(t, []string{
+			"device_name:/dev/bus/0",
+			"device_type:sat+megaraid_1",
+			"controller:megaraid",
+			"controller_member:1",
+		}, metrics.CommonTags)
+	})
+
+	t.Run("should report device identity", func(t *testing.T) {
+		rotationRate := 0
+		data := smartctl.Data{
+			Device: smartctl.DeviceInfo{
+				Name:              "/dev/nvme0n1",
+				FormFactor:        "M.2",
+				WWN:               "5000cca095c7374a",
+				SATAVersion:       "SATA 3.2",
+				NVMePCIVendor:     "0x15b7",
+				UserCapacity:      500107862016,
+				LogicalBlockSize:  512,
+				RotationRate:      &rotationRate,
+				NVMeTotalCapacity: 500107862016,
+			},
+		}
+		require.Empty(t, UnknownTags([]string{"form_factor", "wwn", "sata_version", "nvme_pci_vendor"}))
+		require.Equal(t, []string{""}, UnknownTags([]string{""}))
+
+		converter := New("test", WithTags("device_name", "form_factor", "wwn", "sata_version", "nvme_pci_vendor"), WithDeviceInfo())
+		metrics := converter.Convert(data)
+		require.Equal(t, []string{
+			"device_name:/dev/nvme0n1",
+			"form_factor:M.2",
+			"wwn:5000cca095c7374a",
+			"sata_version:SATA 3.2",
+			"nvme_pci_vendor:0x15b7",
+		}, metrics.CommonTags)
+		require.Equal(t, []metric.Metric{
+			{Name: "test.device.capacity_bytes", Value: 500107862016},
+			{Name: "test.device.logical_block_size", Value: 512},
+			{Name: "test.device.nvme_total_capacity_bytes", Value: 500107862016},
+			{Name: "test.device.rotation_rate", Value: 0},
+		}, metrics.Entries)
+
+		require.Empty(t, converter.Convert(smartctl.Data{}).Entries)
+	})
+
+	t.Run("should report smartctl version", func(t *testing.T) {
+		converter := New("test", WithTags("device_name", "smartctl_version"), WithSmartctlVersion())
+		metrics := converter.Convert(smartctl.Data{
+			Device:          smartctl.DeviceInfo{Name: "/dev/sda"},
+			SmartctlVersion: smartctl.Version{Major: 7, Minor: 2},
+		})
+		require.Equal(t, []string{"device_name:/dev/sda", "smartctl_version:7.2"}, metrics.CommonTags)
+		require.Equal(t, []metric.Metric{
+			{Name: "test.smartctl_version", Value: 1, Tags: []string{"smartctl_version:7.2"}},
+		}, metrics.Entries)
+
+		metrics = converter.Convert(smartctl.Data{Device: smartctl.DeviceInfo{Name: "/dev/sda"}})
+		require.Equal(t, []string{"device_name:/dev/sda"}, metrics.CommonTags)
+		require.Empty(t, metrics.Entries)
+	})
+
+	t.Run("should report query stats", func(t *testing.T) {
+		converter := New("test", WithQueryStats())
+		metrics := converter.Convert(smartctl.Data{
+			Device: smartctl.DeviceInfo{Name: "/dev/sda"},
+			Invocation: smartctl.Invocation{
+				QueueWait: 1500 * time.Millisecond,
+				WallTime:  320 * time.Millisecond,
+				CPUTime:   12 * time.Millisecond,
+			},
+		})
+		require.Equal(t, []metric.Metric{
+			{Name: "test.query.queue_wait_ms", Value: 1500},
+			{Name: "test.query.wall_time_ms", Value: 320},
+			{Name: "test.query.cpu_time_ms", Value: 12},
+		}, metrics.Entries)
+
+		require.Equal(t, metric.DeviceMetrics{
+			Source: "query_limiter",
+			Entries: []metric.Metric{
+				{Name: "test.query.in_flight", Value: 2},
+				{Name: "test.query.waiting", Value: 5},
+			},
+		}, converter.ConvertLimiterStats(smartctl.LimiterStats{InFlight: 2, Waiting: 5}))
+	})
+
+	t.Run("should report query errors by class", func(t *testing.T) {
+		converter := New("test", WithTags("device_name", "controller_member"))
+		device := smartctl.Device{Path: "/dev/bus/0", Type: "megaraid,2"}
+		_, err := smartctl.NewCommand(smartctl.WithSmartctlBinary("testdata/does-not-exist")).QueryDevice(context.Background(), device)
+		require.Error(t, err)
+
+		metrics := converter.ConvertQueryError(device, fmt.Errorf("querying: %w", smartctl.ErrPermissionDenied))
+		require.Equal(t, "/dev/bus/0:megaraid,2", metrics.DeviceID)
+		require.Equal(t, "query_errors", metrics.Source)
+		require.Equal(t, []string{"device_name:/dev/bus/0", "controller_member:2"}, metrics.CommonTags)
+		require.Equal(t, []metric.Metric{
+			{Name: "test.query.errors", Value: 1, Tags: []string{"error_class:permission_denied"}},
+			{Name: "test.query.errors", Value: 0, Tags: []string{"error_class:no_such_device"}},
+			{Name: "test.query.errors", Value: 0, Tags: []string{"error_class:unknown_usb_bridge"}},
+			{Name: "test.query.errors", Value: 0, Tags: []string{"error_class:timeout"}},
+			{Name: "test.query.errors", Value: 0, Tags: []string{"error_class:unsupported_protocol"}},
+			{Name: "test.query.errors", Value: 0, Tags: []string{"error_class:other"}},
+		}, metrics.Entries)
+
+		metrics = converter.ConvertQueryError(device, err)
+		require.Equal(t, 1, metrics.Entries[5].Value)
+
+		for _, entry := range converter.ConvertQueryError(device, nil).Entries {
+			require.Zero(t, entry.Value)
+		}
+	})
+
+	t.Run("should only report power mode of skipped devices", func(t *testing.T) {
+		converter := New("test", WithTags("device_name"), WithHealth(), WithExitStatus(), WithPowerMode())
+
+		metrics := converter.Convert(smartctl.Data{
+			Device:     smartctl.DeviceInfo{Name: "/dev/sdb"},
+			ExitStatus: smartctl.ExitDeviceOpenFailed,
+			Skipped:    true,
+			PowerMode:  smartctl.PowerModeStandby,
+		})
+		require.Equal(t, metric.DeviceMetrics{
+			DeviceName: "/dev/sdb",
+			DeviceID:   "/dev/sdb",
+			Partial:    true,
+			CommonTags: []string{"device_name:/dev/sdb"},
+			Entries:    []metric.Metric{{Name: "test.power_mode", Value: 3}},
+		}, metrics)
+
+		metrics = converter.Convert(smartctl.Data{
+			Device:    smartctl.DeviceInfo{Name: "/dev/sdb"},
+			Health:    smartctl.HealthPassed,
+			PowerMode: smartctl.PowerModeActive,
+		})
+		require.False(t, metrics.Partial)
+		require.Contains(t, metrics.Entries, metric.Metric{Name: "test.power_mode", Value: 1})
+		require.Len(t, metrics.ServiceChecks, 1)
+	})
 }
@@ -3,29 +3,86 @@ package converter
 import (
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/scylladb/go-set/strset"
+
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
 )
 
+// deviceWithTags holds the device properties reported as tags, built
+// explicitly so that new DeviceInfo fields are not tags by default.
 type deviceWithTags struct {
-	Name            string `name:"device_name"`
-	Type            string `name:"device_type"`
-	Protocol        string `name:"device_protocol"`
-	ModelFamily     string `name:"model_family"`
-	ModelName       string `name:"model_name"`
-	SerialNumber    string `name:"serial_number"`
-	FirmwareVersion string `name:"firmware_version"`
+	Name             string `name:"device_name"`
+	Type             string `name:"device_type"`
+	Protocol         string `name:"device_protocol"`
+	ModelFamily      string `name:"model_family"`
+	ModelName        string `name:"model_name"`
+	SerialNumber     string `name:"serial_number"`
+	FirmwareVersion  string `name:"firmware_version"`
+	Controller       string `name:"controller"`
+	ControllerMember string `name:"controller_member"`
+	FormFactor       string `name:"form_factor"`
+	WWN              string `name:"wwn"`
+	SATAVersion      string `name:"sata_version"`
+	NVMePCIVendor    string `name:"nvme_pci_vendor"`
+}
+
+func newDeviceWithTags(info smartctl.DeviceInfo) deviceWithTags {
+	return deviceWithTags{
+		Name:             info.Name,
+		Type:             info.Type,
+		Protocol:         info.Protocol,
+		ModelFamily:      info.ModelFamily,
+		ModelName:        info.ModelName,
+		SerialNumber:     info.SerialNumber,
+		FirmwareVersion:  info.FirmwareVersion,
+		Controller:       info.Controller,
+		ControllerMember: info.ControllerMember,
+		FormFactor:       info.FormFactor,
+		WWN:              info.WWN,
+		SATAVersion:      info.SATAVersion,
+		NVMePCIVendor:    info.NVMePCIVendor,
+	}
 }
 
+// smartctlVersionTag is the version of smartctl which reported the device data.
+const smartctlVersionTag = "smartctl_version"
+
 var supportedTags *strset.Set
 
 func populateSupportedTags() {
 	t := reflect.TypeOf(deviceWithTags{})
-	supportedTags = strset.NewWithSize(t.NumField())
+	supportedTags = strset.NewWithSize(t.NumField() + 1)
 	for idx := 0; idx < t.NumField(); idx++ {
 		field := t.Field(idx)
 		supportedTags.Add(field.Tag.Get("name"))
 	}
+	supportedTags.Add(smartctlVersionTag)
+}
+
+// tagValue normalizes a smartctl string (e.g. "Short offline") for use as a tag value.
+func tagValue(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), " ", "_")
+}
+
+// metricName normalizes a smartctl string (e.g. "R_ERR response for data FIS")
+// for use in a metric name.
+func metricName(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
 }
 
 func UnknownTags(tags []string) []string {
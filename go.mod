@@ -3,17 +3,17 @@ module github.com/j-vizcaino/datadog-smartctl
 go 1.17
 
 require (
+	github.com/DataDog/datadog-go v4.8.3+incompatible
+	github.com/mattn/go-isatty v0.0.14
 	github.com/rs/zerolog v1.26.1
+	github.com/scylladb/go-set v1.0.2
 	github.com/stretchr/objx v0.3.0
 	github.com/stretchr/testify v1.7.0
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
 
 require (
-	github.com/DataDog/datadog-go v4.8.3+incompatible // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/scylladb/go-set v1.0.2 // indirect
 	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
 )
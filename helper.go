@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
+)
+
+// runHelper serves the device queries of the unprivileged daemon until
+// interrupted. Only the configured devices can be queried, each with its own
+// profile.
+func runHelper(cfg Config) {
+	appCtx, abort := context.WithCancel(context.Background())
+	devices := cfg.MonitoredDevices()
+	profiles := []CommandProfile{cfg.Smartctl.CommandProfile()}
+	for _, dev := range devices {
+		profiles = append(profiles, dev.CommandProfile)
+	}
+	checkSmartctlVersions(appCtx, cfg.Smartctl, profiles)
+	checkDriveDBs(appCtx, profiles)
+
+	limiter := smartctl.NewLimiter(cfg.Smartctl.MaxParallelQueries, cfg.Smartctl.SerializeBy)
+	helper := smartctl.NewHelper()
+	for _, dev := range devices {
+		cmd := getSmartctlCommand(dev.CommandProfile, dev.SmartctlLogs(), limiter)
+		if err := helper.Allow(dev.Device(), dev.Profile, cmd); err != nil {
+			log.Fatal().Err(err).Str("device", dev.Device().ID()).Msg("Invalid helper device")
+		}
+	}
+
+	socket := cfg.Helper.Socket
+	listener, err := smartctl.ListenHelper(socket, cfg.Helper.SocketGroup)
+	if err != nil {
+		log.Fatal().Err(err).Str("socket", socket).Msg("Failed to listen on helper socket")
+	}
+
+	go func() {
+		waitForSignal()
+		abort()
+	}()
+	log.Info().Str("socket", socket).Int("devices", len(devices)).Msg("Helper listening")
+	if err := helper.Serve(appCtx, listener); err != nil {
+		log.Fatal().Err(err).Msg("Helper stopped serving")
+	}
+}
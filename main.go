@@ -11,40 +11,103 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/j-vizcaino/datadog-smartctl/poller"
+	"github.com/j-vizcaino/datadog-smartctl/selftest"
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
 )
 
 func main() {
 	setupPrettyLogger()
+	// "datadog-smartctl helper [config]" runs the privileged helper
+	args := os.Args[1:]
+	helperMode := len(args) > 0 && args[0] == "helper"
+	if helperMode {
+		args = args[1:]
+	}
 	cfgFilename := "datadog-smartctl.yaml"
-	if len(os.Args) >=2 {
-		cfgFilename = os.Args[1]
+	if len(args) >= 1 {
+		cfgFilename = args[0]
 	}
 
 	cfg := MustLoadValidConfig(cfgFilename)
+	if helperMode {
+		runHelper(cfg)
+		return
+	}
 
-	queryFunc := getDeviceQuerier(cfg.Smartctl)
+	scanCmd := getSmartctlCommand(cfg.Smartctl.CommandProfile(), nil, nil)
 	submitter, submitterStop := getSubmitter(cfg.Statsd)
 	submitter.Run(5 * time.Second)
 
 	appCtx, abort := context.WithCancel(context.Background())
-	// queryFunc := testDeviceQuery()
+	devices := cfg.MonitoredDevices()
+	profiles := []CommandProfile{cfg.Smartctl.CommandProfile()}
+	for _, dev := range devices {
+		profiles = append(profiles, dev.CommandProfile)
+	}
+	// The helper checks smartctl itself, the daemon not being allowed to run it
+	if !cfg.Helper.Enabled {
+		checkSmartctlVersions(appCtx, cfg.Smartctl, profiles)
+		checkDriveDBs(appCtx, profiles)
+	}
+
+	if cfg.Discovery.Enabled {
+		devices = append(devices, discoverDevices(appCtx, scanCmd, cfg)...)
+	}
+	if len(devices) == 0 {
+		log.Warn().Msg("No device to monitor")
+	}
+
+	// Queries going through the helper are limited by the helper
+	var limiter *smartctl.Limiter
+	if !cfg.Helper.Enabled {
+		limiter = smartctl.NewLimiter(cfg.Smartctl.MaxParallelQueries, cfg.Smartctl.SerializeBy)
+		go reportLimiterStats(appCtx, cfg.Statsd, limiter, submitter)
+	}
+
+	reportError := getQueryErrorReporter(cfg, submitter)
 	var pollers []*poller.Poller
-	for _, dev := range cfg.Devices {
-		p := poller.New(queryFunc, getDataTranslator(cfg, dev, submitter), dev.Path)
+	for _, dev := range devices {
+		var querier deviceQuerier = getSmartctlCommand(dev.CommandProfile, dev.SmartctlLogs(), limiter)
+		if cfg.Helper.Enabled {
+			querier = smartctl.NewHelperClient(cfg.Helper.Socket, dev.Profile, dev.Timeout)
+		}
+		queryFunc := getDeviceQuerier(querier, reportError)
+		// queryFunc := testDeviceQuery()
+		p := poller.New(queryFunc, getDataTranslator(cfg, dev, submitter), dev.Device())
 		log.Info().
-			Str("device", dev.Path).
+			Str("device", dev.Device().ID()).
 			Dur("interval", cfg.Smartctl.PollingInterval).
 			Msg("Starting SMART data periodic poller")
 		p.Poll(appCtx, cfg.Smartctl.PollingInterval)
 		pollers = append(pollers, p)
 	}
 
+	var schedulers []*selftest.Scheduler
+	var offset time.Duration
+	for _, dev := range devices {
+		if len(dev.SelfTests) == 0 {
+			continue
+		}
+		smartCmd := getSmartctlCommand(dev.CommandProfile, dev.SmartctlLogs(), limiter)
+		s := getSelfTestScheduler(cfg, dev, smartCmd, submitter, offset)
+		log.Info().
+			Str("device", dev.Device().ID()).
+			Dur("offset", offset).
+			Msg("Starting self-test scheduler")
+		s.Run(appCtx, cfg.SelfTestScheduler.CheckInterval)
+		schedulers = append(schedulers, s)
+		offset += cfg.SelfTestScheduler.Stagger
+	}
+
 	waitForSignal()
 	abort()
 
 	for _, p := range pollers {
 		p.Stop()
 	}
+	for _, s := range schedulers {
+		s.Stop()
+	}
 	submitterStop()
 }
 
@@ -2,11 +2,38 @@ package metric
 
 type DeviceMetrics struct {
 	DeviceName string
-	CommonTags []string
-	Entries    []Metric
+	// DeviceID tells apart devices sharing the same name, like the members of
+	// a RAID controller.
+	DeviceID string
+	// Source identifies what produced the metrics, when not the device poller.
+	// Submitter keeps the latest metrics of each device and source.
+	Source string
+	// Partial metrics update the latest ones by name, the other metrics and
+	// the tags being kept as is.
+	Partial       bool
+	CommonTags    []string
+	Entries       []Metric
+	ServiceChecks []ServiceCheck
 }
 
 type Metric struct {
 	Name  string
 	Value int
+	Tags  []string // in addition to the device common tags
+}
+
+// ServiceCheckStatus values match the DogStatsD service check statuses.
+type ServiceCheckStatus int
+
+const (
+	ServiceCheckOK ServiceCheckStatus = iota
+	ServiceCheckWarning
+	ServiceCheckCritical
+	ServiceCheckUnknown
+)
+
+type ServiceCheck struct {
+	Name    string
+	Status  ServiceCheckStatus
+	Message string
 }
@@ -8,20 +8,20 @@ import (
 	"github.com/j-vizcaino/datadog-smartctl/smartctl"
 )
 
-type QueryDeviceFunc func(ctx context.Context, dev string) (smartctl.Data, error)
+type QueryDeviceFunc func(ctx context.Context, dev smartctl.Device) (smartctl.Data, error)
 type OnNewDataFunc func(ctx context.Context, data smartctl.Data)
 
 type Poller struct {
 	pollingInterval time.Duration
 	queryDevice     QueryDeviceFunc
 	onNewData       OnNewDataFunc
-	device          string
+	device          smartctl.Device
 	stopChan        chan bool
 	stopOnce        sync.Once
 	running         sync.WaitGroup
 }
 
-func New(queryDevice QueryDeviceFunc, onNewData OnNewDataFunc, device string) *Poller {
+func New(queryDevice QueryDeviceFunc, onNewData OnNewDataFunc, device smartctl.Device) *Poller {
 	return &Poller{
 		queryDevice: queryDevice,
 		onNewData:   onNewData,
@@ -0,0 +1,205 @@
+package selftest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/j-vizcaino/datadog-smartctl/metric"
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
+)
+
+type QueryDeviceFunc func(ctx context.Context, dev smartctl.Device) (smartctl.Data, error)
+type StartSelfTestFunc func(ctx context.Context, dev smartctl.Device, testType smartctl.SelfTestType) error
+type OnReportFunc func(ctx context.Context, data smartctl.Data, report Report)
+
+// Schedule describes when a self-test must be started: every Interval, the
+// first run happening at the given time of day.
+type Schedule struct {
+	Type     smartctl.SelfTestType
+	Interval time.Duration
+	At       time.Duration // time of day, since midnight
+}
+
+// Report holds the self-test activity of a device since the daemon started.
+// Unsupported reports devices without ATA self-test status, e.g. NVMe
+// devices: the scheduler then stops.
+type Report struct {
+	Unsupported      bool
+	Running          bool
+	RemainingPercent int
+	Started          map[smartctl.SelfTestType]int
+	Completed        map[smartctl.SelfTestType]int
+	Failed           map[smartctl.SelfTestType]int
+}
+
+// Metrics returns the report entries, using names relative to the metric prefix.
+func (r Report) Metrics() []metric.Metric {
+	const prefix = "self_test."
+	out := []metric.Metric{
+		{Name: prefix + "in_progress", Value: boolToInt(r.Running)},
+	}
+	if r.Running {
+		out = append(out, metric.Metric{Name: prefix + "remaining_percent", Value: r.RemainingPercent})
+	}
+	for testType, count := range r.Started {
+		tags := []string{"test_type:" + string(testType)}
+		out = append(out,
+			metric.Metric{Name: prefix + "started", Value: count, Tags: tags},
+			metric.Metric{Name: prefix + "completed", Value: r.Completed[testType], Tags: tags},
+			metric.Metric{Name: prefix + "failed", Value: r.Failed[testType], Tags: tags},
+		)
+	}
+	return out
+}
+
+// externalTestBackoff is the time waited before checking again a device
+// running a self-test started by someone else, when a test is due.
+const externalTestBackoff = 15 * time.Minute
+
+// Scheduler periodically starts self-tests on a device, never starting a test
+// while another one is running.
+type Scheduler struct {
+	queryDevice   QueryDeviceFunc
+	startSelfTest StartSelfTestFunc
+	onReport      OnReportFunc
+	device        smartctl.Device
+	schedules     []Schedule
+	offset        time.Duration
+	nextRuns      []time.Time
+	current       smartctl.SelfTestType // test started by the scheduler and not completed yet
+	backoffUntil  time.Time             // while a test started by someone else runs
+	report        Report
+	stopChan      chan bool
+	stopOnce      sync.Once
+	running       sync.WaitGroup
+}
+
+// New creates a scheduler for the device. offset delays all the schedules of
+// the device, so that tests can be staggered across disks.
+func New(queryDevice QueryDeviceFunc, startSelfTest StartSelfTestFunc, onReport OnReportFunc, device smartctl.Device, offset time.Duration, schedules ...Schedule) *Scheduler {
+	return &Scheduler{
+		queryDevice:   queryDevice,
+		startSelfTest: startSelfTest,
+		onReport:      onReport,
+		device:        device,
+		schedules:     schedules,
+		offset:        offset,
+		report: Report{
+			Started:   make(map[smartctl.SelfTestType]int),
+			Completed: make(map[smartctl.SelfTestType]int),
+			Failed:    make(map[smartctl.SelfTestType]int),
+		},
+		stopChan: make(chan bool),
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context, checkInterval time.Duration) {
+	s.planRuns(time.Now())
+	s.running.Add(1)
+	go s.periodicCheck(ctx, checkInterval)
+}
+
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	s.running.Wait()
+}
+
+func (s *Scheduler) periodicCheck(ctx context.Context, checkInterval time.Duration) {
+	run := true
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for run {
+		select {
+		case now := <-ticker.C:
+			s.check(ctx, now)
+		case <-ctx.Done():
+			run = false
+		case <-s.stopChan:
+			run = false
+		}
+	}
+	s.running.Done()
+}
+
+func (s *Scheduler) planRuns(now time.Time) {
+	s.nextRuns = make([]time.Time, len(s.schedules))
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for idx, schedule := range s.schedules {
+		next := midnight.Add(schedule.At + s.offset)
+		for !next.After(now) {
+			next = next.Add(24 * time.Hour)
+		}
+		s.nextRuns[idx] = next
+	}
+}
+
+// dueSchedule returns the index of the first schedule due at the given time, -1 if none.
+func (s *Scheduler) dueSchedule(now time.Time) int {
+	for idx, next := range s.nextRuns {
+		if !next.After(now) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (s *Scheduler) check(ctx context.Context, now time.Time) {
+	due := s.dueSchedule(now)
+	if s.current == "" && (due < 0 || now.Before(s.backoffUntil)) {
+		return
+	}
+
+	data, err := s.queryDevice(ctx, s.device)
+	if err != nil {
+		return
+	}
+	if data.ATASelfTestStatus == nil {
+		s.nextRuns = nil
+		s.current = ""
+		s.report.Unsupported = true
+		s.onReport(ctx, data, s.report)
+		return
+	}
+	status := *data.ATASelfTestStatus
+	running, remaining := status.InProgress(), status.RemainingPercent
+
+	if s.current != "" && !status.InProgress() {
+		s.report.Completed[s.current]++
+		if status.Failed() {
+			s.report.Failed[s.current]++
+		}
+		s.current = ""
+	}
+
+	if due >= 0 && running && s.current == "" {
+		s.backoffUntil = now.Add(externalTestBackoff)
+	}
+	if due >= 0 && !running {
+		schedule := s.schedules[due]
+		if err := s.startSelfTest(ctx, s.device, schedule.Type); err == nil {
+			s.report.Started[schedule.Type]++
+			s.current = schedule.Type
+			running, remaining = true, 100
+		}
+		// Failing to start the test must not retry at every check
+		next := s.nextRuns[due]
+		for !next.After(now) {
+			next = next.Add(schedule.Interval)
+		}
+		s.nextRuns[due] = next
+	}
+
+	s.report.Running = running
+	s.report.RemainingPercent = remaining
+	s.onReport(ctx, data, s.report)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/j-vizcaino/datadog-smartctl/metric"
+	"github.com/j-vizcaino/datadog-smartctl/smartctl"
+)
+
+type fakeDevice struct {
+	status   smartctl.SelfTestStatus
+	noStatus bool // as NVMe devices
+	queries  int
+	started  []smartctl.SelfTestType
+	startErr error
+	reports  []Report
+}
+
+func (f *fakeDevice) scheduler(offset time.Duration, schedules ...Schedule) *Scheduler {
+	query := func(_ context.Context, _ smartctl.Device) (smartctl.Data, error) {
+		f.queries++
+		if f.noStatus {
+			return smartctl.Data{}, nil
+		}
+		status := f.status
+		return smartctl.Data{ATASelfTestStatus: &status}, nil
+	}
+	start := func(_ context.Context, _ smartctl.Device, testType smartctl.SelfTestType) error {
+		if f.startErr != nil {
+			return f.startErr
+		}
+		f.started = append(f.started, testType)
+		f.status = smartctl.SelfTestStatus{Value: 0xf9, RemainingPercent: 90}
+		return nil
+	}
+	onReport := func(_ context.Context, _ smartctl.Data, report Report) {
+		f.reports = append(f.reports, report)
+	}
+	return New(query, start, onReport, smartctl.Device{Path: "/dev/sda"}, offset, schedules...)
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	startDate := time.Date(2022, time.April, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should plan first runs at time of day, with offset", func(t *testing.T) {
+		s := (&fakeDevice{}).scheduler(30*time.Minute,
+			Schedule{Type: smartctl.SelfTestShort, Interval: 24 * time.Hour, At: 3 * time.Hour},
+			Schedule{Type: smartctl.SelfTestLong, Interval: 30 * 24 * time.Hour, At: 14 * time.Hour},
+		)
+		s.planRuns(startDate)
+		require.Equal(t, []time.Time{
+			time.Date(2022, time.April, 19, 3, 30, 0, 0, time.UTC),
+			time.Date(2022, time.April, 18, 14, 30, 0, 0, time.UTC),
+		}, s.nextRuns)
+	})
+
+	t.Run("should start due tests and track completion", func(t *testing.T) {
+		dev := &fakeDevice{}
+		s := dev.scheduler(0, Schedule{Type: smartctl.SelfTestShort, Interval: 24 * time.Hour, At: 13 * time.Hour})
+		s.planRuns(startDate)
+
+		// Not due yet, device is not queried
+		s.check(ctx, startDate.Add(30*time.Minute))
+		require.Empty(t, dev.started)
+		require.Empty(t, dev.reports)
+
+		s.check(ctx, startDate.Add(time.Hour))
+		require.Equal(t, []smartctl.SelfTestType{smartctl.SelfTestShort}, dev.started)
+		require.Equal(t, startDate.Add(25*time.Hour), s.nextRuns[0])
+		require.True(t, dev.reports[0].Running)
+
+		// Test still running
+		s.check(ctx, startDate.Add(time.Hour+time.Minute))
+		require.Len(t, dev.reports, 2)
+		require.True(t, dev.reports[1].Running)
+		require.Equal(t, 90, dev.reports[1].RemainingPercent)
+
+		// Test failed
+		dev.status = smartctl.SelfTestStatus{Value: 0x79}
+		s.check(ctx, startDate.Add(time.Hour+2*time.Minute))
+		require.Len(t, dev.reports, 3)
+		require.False(t, dev.reports[2].Running)
+		require.Equal(t, 1, dev.reports[2].Started[smartctl.SelfTestShort])
+		require.Equal(t, 1, dev.reports[2].Completed[smartctl.SelfTestShort])
+		require.Equal(t, 1, dev.reports[2].Failed[smartctl.SelfTestShort])
+
+		require.ElementsMatch(t, []metric.Metric{
+			{Name: "self_test.in_progress", Value: 0},
+			{Name: "self_test.started", Value: 1, Tags: []string{"test_type:short"}},
+			{Name: "self_test.completed", Value: 1, Tags: []string{"test_type:short"}},
+			{Name: "self_test.failed", Value: 1, Tags: []string{"test_type:short"}},
+		}, dev.reports[2].Metrics())
+
+		// Nothing to do anymore
+		s.check(ctx, startDate.Add(2*time.Hour))
+		require.Len(t, dev.reports, 3)
+	})
+
+	t.Run("should not start a test while another one is running", func(t *testing.T) {
+		dev := &fakeDevice{status: smartctl.SelfTestStatus{Value: 0xf5, RemainingPercent: 50}}
+		s := dev.scheduler(0, Schedule{Type: smartctl.SelfTestLong, Interval: 24 * time.Hour, At: 13 * time.Hour})
+		s.planRuns(startDate)
+
+		s.check(ctx, startDate.Add(time.Hour))
+		require.Empty(t, dev.started)
+		require.Equal(t, startDate.Add(time.Hour), s.nextRuns[0])
+
+		// Backing off while the other test runs
+		s.check(ctx, startDate.Add(time.Hour+time.Minute))
+		require.Equal(t, 1, dev.queries)
+
+		dev.status = smartctl.SelfTestStatus{}
+		s.check(ctx, startDate.Add(2*time.Hour))
+		require.Equal(t, []smartctl.SelfTestType{smartctl.SelfTestLong}, dev.started)
+		require.Equal(t, startDate.Add(25*time.Hour), s.nextRuns[0])
+	})
+
+	t.Run("should wait for next run when test cannot start", func(t *testing.T) {
+		dev := &fakeDevice{startErr: errors.New("not supported")}
+		s := dev.scheduler(0, Schedule{Type: smartctl.SelfTestShort, Interval: 24 * time.Hour, At: 13 * time.Hour})
+		s.planRuns(startDate)
+
+		s.check(ctx, startDate.Add(time.Hour))
+		require.Empty(t, dev.started)
+		require.Equal(t, startDate.Add(25*time.Hour), s.nextRuns[0])
+	})
+
+	t.Run("should stop on devices without ATA self-test status", func(t *testing.T) {
+		dev := &fakeDevice{noStatus: true}
+		s := dev.scheduler(0, Schedule{Type: smartctl.SelfTestShort, Interval: 24 * time.Hour, At: 13 * time.Hour})
+		s.planRuns(startDate)
+
+		s.check(ctx, startDate.Add(time.Hour))
+		require.Empty(t, dev.started)
+		require.Len(t, dev.reports, 1)
+		require.True(t, dev.reports[0].Unsupported)
+
+		s.check(ctx, startDate.Add(25*time.Hour))
+		require.Equal(t, 1, dev.queries)
+		require.Len(t, dev.reports, 1)
+	})
+}
@@ -0,0 +1,62 @@
+package smartctl
+
+import (
+	"strings"
+)
+
+// ATAErrorLog is the ATA SMART error log.
+type ATAErrorLog struct {
+	Count   int             // total number of errors, including the ones no longer logged
+	Entries []ATAErrorEntry // most recent first
+}
+
+type ATAErrorEntry struct {
+	ErrorNumber   int
+	LifetimeHours int
+	Description   string // e.g. "Error: UNC at LBA = 0x0001e240 = 123456"
+}
+
+// ErrorTypes returns the error flags of the entry description, e.g. UNC, ICRC or ABRT.
+func (e ATAErrorEntry) ErrorTypes() []string {
+	desc := strings.TrimPrefix(e.Description, "Error: ")
+	if idx := strings.Index(desc, " at LBA"); idx >= 0 {
+		desc = desc[:idx]
+	}
+
+	var out []string
+	for _, field := range strings.Split(desc, ",") {
+		// Drop the sector count, as in "ICRC, ABRT 8 sectors"
+		words := strings.Fields(field)
+		if len(words) == 0 {
+			continue
+		}
+		out = append(out, words[0])
+	}
+	return out
+}
+
+func extractATAErrorLog(out *jsonOutput) *ATAErrorLog {
+	if out.ATASmartErrorLog == nil {
+		return nil
+	}
+	// Prefer the extended log (-l xerror) over the summary one (-l error)
+	log := out.ATASmartErrorLog.Extended
+	if log == nil {
+		log = out.ATASmartErrorLog.Summary
+	}
+	if log == nil {
+		return nil
+	}
+
+	res := &ATAErrorLog{
+		Count: log.Count,
+	}
+	for _, entry := range log.Table {
+		res.Entries = append(res.Entries, ATAErrorEntry{
+			ErrorNumber:   entry.ErrorNumber,
+			LifetimeHours: entry.LifetimeHours,
+			Description:   entry.ErrorDescription,
+		})
+	}
+	return res
+}
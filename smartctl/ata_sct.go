@@ -0,0 +1,107 @@
+package smartctl
+
+// ATASCTStatus is the ATA SMART Command Transport (SCT) status, with
+// temperatures in Celsius.
+type ATASCTStatus struct {
+	DeviceState      string
+	Current          int
+	PowerCycleMin    int
+	PowerCycleMax    int
+	LifetimeMin      int
+	LifetimeMax      int
+	UnderLimitCount  int
+	OverLimitCount   int
+	TemperatureLimit TemperatureLimits
+}
+
+// TemperatureLimits are the recommended operating and absolute temperature
+// limits of the device, in Celsius.
+type TemperatureLimits struct {
+	OpLimitMin int
+	OpLimitMax int
+	LimitMin   int
+	LimitMax   int
+}
+
+// Known returns false when the device did not report temperature limits.
+func (l TemperatureLimits) Known() bool {
+	return l.OpLimitMax != 0 || l.LimitMax != 0
+}
+
+// ATASCTTemperatureHistory is the SCT temperature history table.
+type ATASCTTemperatureHistory struct {
+	SamplingPeriodMinutes  int
+	LoggingIntervalMinutes int
+	TemperatureLimit       TemperatureLimits
+	Samples                []int // oldest first, without the missing samples
+}
+
+// MinMax returns the lowest and highest temperatures of the history.
+func (h ATASCTTemperatureHistory) MinMax() (int, int, bool) {
+	if len(h.Samples) == 0 {
+		return 0, 0, false
+	}
+	min, max := h.Samples[0], h.Samples[0]
+	for _, sample := range h.Samples[1:] {
+		if sample < min {
+			min = sample
+		}
+		if sample > max {
+			max = sample
+		}
+	}
+	return min, max, true
+}
+
+func extractTemperatureLimits(limits jsonTemperatureLimits) TemperatureLimits {
+	return TemperatureLimits{
+		OpLimitMin: limits.OpLimitMin,
+		OpLimitMax: limits.OpLimitMax,
+		LimitMin:   limits.LimitMin,
+		LimitMax:   limits.LimitMax,
+	}
+}
+
+func extractATASCTTemperatureHistory(out *jsonOutput) *ATASCTTemperatureHistory {
+	history := out.ATASCTTemperatureHistory
+	if history == nil {
+		return nil
+	}
+
+	res := &ATASCTTemperatureHistory{
+		SamplingPeriodMinutes:  history.SamplingPeriodMinutes,
+		LoggingIntervalMinutes: history.LoggingIntervalMinutes,
+		TemperatureLimit:       extractTemperatureLimits(history.Temperature),
+	}
+	for _, sample := range history.Table {
+		if sample != nil {
+			res.Samples = append(res.Samples, *sample)
+		}
+	}
+	return res
+}
+
+func extractATASCTStatus(out *jsonOutput, history *ATASCTTemperatureHistory) *ATASCTStatus {
+	status := out.ATASCTStatus
+	if status == nil {
+		return nil
+	}
+
+	temp := status.Temperature
+	res := &ATASCTStatus{
+		DeviceState:      status.DeviceState.String,
+		Current:          temp.Current,
+		PowerCycleMin:    temp.PowerCycleMin,
+		PowerCycleMax:    temp.PowerCycleMax,
+		LifetimeMin:      temp.LifetimeMin,
+		LifetimeMax:      temp.LifetimeMax,
+		UnderLimitCount:  temp.UnderLimitCount,
+		OverLimitCount:   temp.OverLimitCount,
+		TemperatureLimit: extractTemperatureLimits(temp.jsonTemperatureLimits),
+	}
+	// Depending on the SCT version, limits are only reported with the history
+	if !res.TemperatureLimit.Known() && history != nil {
+		res.TemperatureLimit = history.TemperatureLimit
+	}
+	return res
+}
@@ -0,0 +1,126 @@
+package smartctl
+
+// SelfTestType is a self-test type, as passed to smartctl -t.
+type SelfTestType string
+
+const (
+	SelfTestShort      SelfTestType = "short"
+	SelfTestLong       SelfTestType = "long"
+	SelfTestConveyance SelfTestType = "conveyance"
+)
+
+func (t SelfTestType) Valid() bool {
+	switch t {
+	case SelfTestShort, SelfTestLong, SelfTestConveyance:
+		return true
+	}
+	return false
+}
+
+// SelfTestStatus is the current self-test execution status of an ATA device.
+type SelfTestStatus struct {
+	Value            int
+	String           string
+	RemainingPercent int
+}
+
+// InProgress returns true when a self-test is currently running.
+func (s SelfTestStatus) InProgress() bool {
+	return s.Value>>4 == 0xf
+}
+
+// Failed returns true when the last self-test completed with a failure.
+// Tests aborted by the host or interrupted by a reset are not failures.
+func (s SelfTestStatus) Failed() bool {
+	code := s.Value >> 4
+	return code >= 3 && code <= 8
+}
+
+// ATASelfTestLog is the ATA SMART self-test log.
+type ATASelfTestLog struct {
+	Count           int
+	ErrorCountTotal int
+	Entries         []ATASelfTestEntry // most recent first
+}
+
+type ATASelfTestEntry struct {
+	Type          string // Short offline, Extended offline, Conveyance offline...
+	Status        int    // self-test execution status byte
+	StatusString  string
+	Failed        bool
+	LifetimeHours int
+	LBA           int // LBA of first error, only set when the test failed
+}
+
+// StatusCode returns the self-test execution status code, 0 meaning the test
+// completed without error.
+func (e ATASelfTestEntry) StatusCode() int {
+	return e.Status >> 4
+}
+
+// LastByType returns the most recent entry of each self-test type.
+func (l ATASelfTestLog) LastByType() []ATASelfTestEntry {
+	var out []ATASelfTestEntry
+	seen := make(map[string]bool)
+	for _, entry := range l.Entries {
+		if seen[entry.Type] {
+			continue
+		}
+		seen[entry.Type] = true
+		out = append(out, entry)
+	}
+	return out
+}
+
+// LastFailed returns the most recent failed entry.
+func (l ATASelfTestLog) LastFailed() (ATASelfTestEntry, bool) {
+	for _, entry := range l.Entries {
+		if entry.Failed {
+			return entry, true
+		}
+	}
+	return ATASelfTestEntry{}, false
+}
+
+func extractATASelfTestStatus(out *jsonOutput) *SelfTestStatus {
+	if out.ATASmartData == nil || out.ATASmartData.SelfTest == nil || out.ATASmartData.SelfTest.Status == nil {
+		return nil
+	}
+	status := out.ATASmartData.SelfTest.Status
+	return &SelfTestStatus{
+		Value:            status.Value,
+		String:           status.String,
+		RemainingPercent: status.RemainingPercent,
+	}
+}
+
+func extractATASelfTestLog(out *jsonOutput) *ATASelfTestLog {
+	if out.ATASmartSelfTestLog == nil {
+		return nil
+	}
+	// Prefer the extended log (-l xselftest) over the standard one (-l selftest)
+	log := out.ATASmartSelfTestLog.Extended
+	if log == nil {
+		log = out.ATASmartSelfTestLog.Standard
+	}
+	if log == nil {
+		return nil
+	}
+
+	res := &ATASelfTestLog{
+		Count:           log.Count,
+		ErrorCountTotal: log.ErrorCountTotal,
+	}
+	for _, entry := range log.Table {
+		passed := entry.Status.Passed
+		res.Entries = append(res.Entries, ATASelfTestEntry{
+			Type:          entry.Type.String,
+			Status:        entry.Status.Value,
+			StatusString:  entry.Status.String,
+			Failed:        passed != nil && !*passed,
+			LifetimeHours: entry.LifetimeHours,
+			LBA:           entry.LBA,
+		})
+	}
+	return res
+}
@@ -0,0 +1,25 @@
+package smartctl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Example presets: "9,minutes", "1,raw48:54,Raw_Read_Error_Rate", "N,raw48",
+// "9,raw48,Power_On_Hours,HDD"
+var attributePresetRegexp = regexp.MustCompile(`^(\d+|N),[^,\s]+(,[^,\s]+(,(HDD|SSD))?)?$`)
+
+// ValidateAttributePreset checks the format of a smartctl -v preset,
+// ID,FORMAT[:BYTEORDER][,NAME[,HDD|SSD]], ID being an attribute ID or N for
+// all of them, the last field restricting the preset to a drive type.
+func ValidateAttributePreset(preset string) error {
+	match := attributePresetRegexp.FindStringSubmatch(preset)
+	if match == nil {
+		return fmt.Errorf("invalid attribute preset %q, expected ID,FORMAT[,NAME[,HDD|SSD]]", preset)
+	}
+	if id, err := strconv.Atoi(match[1]); err == nil && (id < 1 || id > 255) {
+		return fmt.Errorf("invalid attribute preset %q, ID must be 1 to 255", preset)
+	}
+	return nil
+}
@@ -4,109 +4,299 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-
-	"github.com/stretchr/objx"
 )
 
 type DeviceInfo struct {
 	Name            string // /dev/xxx
-	Type            string // nvme, sat
-	Protocol        string // NVMe, ATA
+	Type            string // nvme, sat, scsi
+	Protocol        string // NVMe, ATA, SCSI
 	ModelFamily     string
 	ModelName       string
 	SerialNumber    string
 	FirmwareVersion string
+	// RAID controller the device is a member of, e.g. megaraid, and its member
+	// number. Both are empty for devices not behind a RAID controller.
+	Controller       string
+	ControllerMember string
+	FormFactor       string // e.g. "3.5 inches"
+	WWN              string // World Wide Name, as 16 hexadecimal digits
+	SATAVersion      string // e.g. "SATA 3.2"
+	NVMePCIVendor    string // PCI vendor ID, e.g. "0x15b7"
+	// Numeric properties are zero when not reported by smartctl. The rotation
+	// rate is nil when unknown, zero for solid state devices.
+	UserCapacity      int // bytes
+	LogicalBlockSize  int // bytes
+	RotationRate      *int
+	NVMeTotalCapacity int // bytes
+}
+
+// ID uniquely identifies the device, see Device.ID.
+func (d DeviceInfo) ID() string {
+	return deviceID(d.Name, d.Type)
+}
+
+// ATASmartAttribute is a row of the ATA SMART attributes table.
+type ATASmartAttribute struct {
+	ID         int
+	Name       string
+	Value      int // normalized value
+	Worst      int
+	Thresh     int
+	WhenFailed string // empty, "now" or "past"
+	Flags      ATAAttributeFlags
+	Raw        int
+	RawString  string
+	Decoded    int // raw value decoded by the raw decoders, see RawDecoders
+	// Parts of packed raw values by name, e.g. errors and operations, see
+	// RawDecoderRule
+	Parts map[string]int
+}
+
+// ThresholdMargin returns how far the normalized value is from the failure threshold.
+func (a ATASmartAttribute) ThresholdMargin() int {
+	return a.Value - a.Thresh
+}
+
+// ATAAttributeFlags is the ATA SMART attribute flags bitmask.
+type ATAAttributeFlags int
+
+const (
+	ATAAttributePrefailure ATAAttributeFlags = 1 << iota
+	ATAAttributeUpdatedOnline
+	ATAAttributePerformance
+	ATAAttributeErrorRate
+	ATAAttributeEventCount
+	ATAAttributeAutoKeep
+)
+
+// Has returns true when all the bits of flag are set.
+func (f ATAAttributeFlags) Has(flag ATAAttributeFlags) bool {
+	return f&flag == flag
 }
 
+// HealthStatus is the result of the SMART overall-health self-assessment test.
+type HealthStatus int
+
+const (
+	HealthUnknown HealthStatus = iota
+	HealthPassed
+	HealthFailed
+)
+
 type Data struct {
-	Device              DeviceInfo
-	NVMeSmartHealthInfo map[string]int
-	ATASmartAttributes  map[string]int
-	ATADeviceStats      map[string]int
+	Device                       DeviceInfo
+	ExitStatus                   ExitStatus
+	SmartctlVersion              Version
+	Skipped                      bool // not queried because of its power mode, only Device and PowerMode are set
+	PowerMode                    PowerMode
+	Health                       HealthStatus
+	PowerOnHours                 int
+	NVMeSmartHealthInfo          map[string]int
+	NVMeErrorInfoLog             *NVMeErrorInfoLog
+	NVMeSelfTestLog              *NVMeSelfTestLog
+	ATASmartAttributesDuplicates []string // lower-cased names shared by several attributes
+	ATASmartAttributesTable      []ATASmartAttribute
+	ATADeviceStats               map[string]int
+	ATASelfTestLog               *ATASelfTestLog
+	ATASelfTestStatus            *SelfTestStatus
+	ATAErrorLog                  *ATAErrorLog
+	ATASCTStatus                 *ATASCTStatus
+	ATASCTTemperatureHistory     *ATASCTTemperatureHistory
+	SATAPhyEventCounters         []SATAPhyEventCounter
+	SCSIGrownDefectList          *int
+	SCSIErrorCounterLog          *SCSIErrorCounterLog
+	SCSIStartStopCycleCounter    *SCSIStartStopCycleCounter
+	SCSIPercentageUsedEndurance  *int
+	SCSITemperature              *Temperature
+	Invocation                   Invocation
+	MissingFields                []string // expected JSON fields not reported by smartctl, e.g. smart_status.passed
+}
+
+// NewData decodes the JSON output of a smartctl device query.
+// Raw values are decoded using the default decoders.
+func NewData(output []byte) (Data, error) {
+	var out jsonOutput
+	if err := decodeOutput(output, &out); err != nil {
+		return Data{}, err
+	}
+	return newData(&out, nil)
 }
 
-func NewData(raw objx.Map) (Data, error) {
-	res := Data{Device: extractDeviceInfo(raw)}
+func newData(out *jsonOutput, decoders *RawDecoders) (Data, error) {
+	var missing missingFields
+	res := Data{
+		Device:          extractDeviceInfo(out),
+		ExitStatus:      ExitStatus(out.Smartctl.ExitStatus),
+		SmartctlVersion: parseVersion(out.Smartctl.Version),
+		Health:          extractHealthStatus(out),
+		PowerOnHours:    extractPowerOnHours(out),
+	}
+	if mode := skippedPowerMode(out.Smartctl.Messages); mode != PowerModeUnknown {
+		return Data{
+			Device:          res.Device,
+			ExitStatus:      res.ExitStatus,
+			SmartctlVersion: res.SmartctlVersion,
+			Skipped:         true,
+			PowerMode:       mode,
+		}, nil
+	}
+	if res.ExitStatus.Fatal() {
+		return Data{}, exitStatusError(out.Smartctl.Messages, "smartctl", res.ExitStatus)
+	}
 
+	missing.check(out.Device != nil, "device")
+	missing.check(res.Health != HealthUnknown, "smart_status.passed")
+	missing.check(out.PowerOnTime != nil && out.PowerOnTime.Hours != nil, "power_on_time.hours")
+
+	// Optional logs (SCT, phy event counters, NVMe logs...) are only reported
+	// when requested, their absence is not a missing field.
 	switch res.Device.Protocol {
 	case "NVMe":
-		res.NVMeSmartHealthInfo = extractNVMeHealthInformation(raw)
+		if missing.check(out.NVMeSmartHealthInformationLog != nil, "nvme_smart_health_information_log") {
+			res.NVMeSmartHealthInfo = out.NVMeSmartHealthInformationLog.Map()
+		}
+		res.NVMeErrorInfoLog = extractNVMeErrorInfoLog(out)
+		res.NVMeSelfTestLog = extractNVMeSelfTestLog(out)
 	case "ATA":
-		res.ATASmartAttributes = extractATASmartAttributes(raw)
-		res.ATADeviceStats = extractATADeviceStats(raw)
+		if missing.check(out.ATASmartAttributes != nil, "ata_smart_attributes") {
+			res.ATASmartAttributesTable = extractATASmartAttributesTable(out, decoders, &missing)
+			res.ATASmartAttributesDuplicates = duplicateATASmartAttributes(res.ATASmartAttributesTable)
+		}
+		if missing.check(out.ATADeviceStatistics != nil, "ata_device_statistics") {
+			res.ATADeviceStats = extractATADeviceStats(out)
+		}
+		res.ATASelfTestLog = extractATASelfTestLog(out)
+		missing.check(res.ATASelfTestLog != nil, "ata_smart_self_test_log")
+		res.ATASelfTestStatus = extractATASelfTestStatus(out)
+		missing.check(res.ATASelfTestStatus != nil, "ata_smart_data.self_test.status")
+		res.ATAErrorLog = extractATAErrorLog(out)
+		missing.check(res.ATAErrorLog != nil, "ata_smart_error_log")
+		res.ATASCTTemperatureHistory = extractATASCTTemperatureHistory(out)
+		res.ATASCTStatus = extractATASCTStatus(out, res.ATASCTTemperatureHistory)
+		res.SATAPhyEventCounters = extractSATAPhyEventCounters(out)
+	case "SCSI":
+		res.SCSIGrownDefectList = out.SCSIGrownDefectList
+		missing.check(res.SCSIGrownDefectList != nil, "scsi_grown_defect_list")
+		res.SCSIErrorCounterLog = extractSCSIErrorCounterLog(out)
+		missing.check(res.SCSIErrorCounterLog != nil, "scsi_error_counter_log")
+		res.SCSIStartStopCycleCounter = extractSCSIStartStopCycleCounter(out)
+		res.SCSIPercentageUsedEndurance = out.SCSIPercentageUsedEnduranceIndicator
+		res.SCSITemperature = extractTemperature(out)
+		missing.check(res.SCSITemperature != nil, "temperature.current")
 	case "":
 		return Data{}, errors.New("undetected device protocol, empty or missing device.protocol JSON field")
 	default:
-		return Data{}, fmt.Errorf("unsupported device protocol %s (expected ATA or NMVe)", res.Device.Protocol)
+		return Data{}, fmt.Errorf("%w: %s (expected ATA, NVMe or SCSI)", ErrUnsupportedProtocol, res.Device.Protocol)
 	}
 
+	res.MissingFields = missing
 	return res, nil
 }
 
-func extractDeviceInfo(m objx.Map) DeviceInfo {
-	return DeviceInfo{
-		Name:            m.Get("device.name").String(),
-		Type:            m.Get("device.type").String(),
-		Protocol:        m.Get("device.protocol").String(),
-		ModelFamily:     m.Get("model_family").String(),
-		ModelName:       m.Get("model_name").String(),
-		SerialNumber:    m.Get("serial_number").String(),
-		FirmwareVersion: m.Get("firmware_version").String(),
+func extractDeviceInfo(out *jsonOutput) DeviceInfo {
+	info := DeviceInfo{
+		ModelFamily:     out.ModelFamily,
+		ModelName:       out.ModelName,
+		SerialNumber:    out.SerialNumber,
+		FirmwareVersion: out.FirmwareVersion,
+
+		LogicalBlockSize:  out.LogicalBlockSize,
+		RotationRate:      out.RotationRate,
+		NVMeTotalCapacity: out.NVMeTotalCapacity,
+	}
+	if out.UserCapacity != nil {
+		info.UserCapacity = out.UserCapacity.Bytes
+	}
+	if out.FormFactor != nil {
+		info.FormFactor = out.FormFactor.Name
+	}
+	if out.WWN != nil {
+		// Same layout as smartctl "LU WWN Device Id: 5 0014ee 2b5c1b1e4a"
+		info.WWN = fmt.Sprintf("%x%06x%09x", out.WWN.NAA, out.WWN.OUI, out.WWN.ID)
+	}
+	if out.SATAVersion != nil {
+		info.SATAVersion = out.SATAVersion.String
 	}
+	if out.NVMePCIVendor != nil {
+		info.NVMePCIVendor = fmt.Sprintf("%#04x", out.NVMePCIVendor.ID)
+	}
+	if out.Device != nil {
+		info.Name = out.Device.Name
+		info.Type = out.Device.Type
+		info.Protocol = out.Device.Protocol
+		info.Controller, info.ControllerMember = parseControllerMember(out.Device.Type)
+	}
+	return info
 }
 
-func extractATASmartAttributes(m objx.Map) map[string]int {
-	out := make(map[string]int)
-	m.Get("ata_smart_attributes.table").EachObjxMap(func(_ int, obj objx.Map) bool {
-		name := obj.Get("name").String()
-		name = strings.ToLower(name)
-
-		value := obj.Get("raw.value").Int()
-
-		// NOTE: temperature raw value is borked, we need to parse the string representation.
-		// Example string: "26 (35 33 36 35 0)", with 26 being the current temperature
-		if name == "temperature_celsius" {
-			var temp int
-			valueStr := obj.Get("raw.string").String()
-			if _, err := fmt.Sscan(valueStr, &temp); err == nil {
-				value = temp
-			}
-		}
+func extractHealthStatus(out *jsonOutput) HealthStatus {
+	if out.SmartStatus == nil || out.SmartStatus.Passed == nil {
+		return HealthUnknown
+	}
+	if *out.SmartStatus.Passed {
+		return HealthPassed
+	}
+	return HealthFailed
+}
 
-		out[name] = value
-		return true
-	})
-	return out
+func extractPowerOnHours(out *jsonOutput) int {
+	if out.PowerOnTime == nil || out.PowerOnTime.Hours == nil {
+		return 0
+	}
+	return *out.PowerOnTime.Hours
 }
 
-func extractATADeviceStats(m objx.Map) map[string]int {
-	if !m.Has("ata_device_statistics") {
-		return nil
+func extractATASmartAttributesTable(out *jsonOutput, decoders *RawDecoders, missing *missingFields) []ATASmartAttribute {
+	var res []ATASmartAttribute
+	for _, attr := range out.ATASmartAttributes.Table {
+		row := newATASmartAttribute(attr)
+		if missing.check(attr.Raw != nil, "ata_smart_attributes.table."+strings.ToLower(attr.Name)+".raw") {
+			row.Decoded = decoders.Decode(out.ModelFamily, row)
+			row.Parts = decoders.DecodeParts(out.ModelFamily, row)
+		}
+		res = append(res, row)
 	}
+	return res
+}
 
-	out := make(map[string]int)
-	m.Get("ata_device_statistics.pages").EachObjxMap(func(_ int, page objx.Map) bool {
-		if !page.Has("table") {
-			return true
+func newATASmartAttribute(attr jsonATASmartAttribute) ATASmartAttribute {
+	res := ATASmartAttribute{
+		ID:         attr.ID,
+		Name:       attr.Name,
+		Value:      attr.Value,
+		Worst:      attr.Worst,
+		Thresh:     attr.Thresh,
+		WhenFailed: attr.WhenFailed,
+		Flags:      ATAAttributeFlags(attr.Flags.Value),
+	}
+	if attr.Raw != nil {
+		res.Raw = attr.Raw.Value
+		res.RawString = attr.Raw.String
+	}
+	return res
+}
+
+// duplicateATASmartAttributes returns the lower-cased names shared by several
+// attributes, e.g. unknown_attribute.
+func duplicateATASmartAttributes(table []ATASmartAttribute) []string {
+	var out []string
+	count := make(map[string]int, len(table))
+	for _, attr := range table {
+		name := strings.ToLower(attr.Name)
+		count[name]++
+		if count[name] == 2 {
+			out = append(out, name)
 		}
-		page.Get("table").EachObjxMap(func(_ int, entry objx.Map) bool {
-			name := entry.Get("name").String()
-			name = strings.ToLower(name)
-
-			out[name] = entry.Get("value").Int()
-			return true
-		})
-		return true
-	})
+	}
 	return out
 }
 
-func extractNVMeHealthInformation(m objx.Map) map[string]int {
-	out := make(map[string]int)
-	healthInfo := m.Get("nvme_smart_health_information_log").ObjxMap()
-	for key := range healthInfo {
-		name := strings.ToLower(key)
-		out[name] = healthInfo.Get(key).Int()
+func extractATADeviceStats(out *jsonOutput) map[string]int {
+	res := make(map[string]int)
+	for _, page := range out.ATADeviceStatistics.Pages {
+		for _, entry := range page.Table {
+			res[strings.ToLower(entry.Name)] = entry.Value
+		}
 	}
-	return out
+	return res
 }
@@ -0,0 +1,63 @@
+package smartctl
+
+import (
+	"strings"
+)
+
+// controllerTypes are the RAID controllers smartctl reaches member disks
+// through, using -d <controller>,<member>.
+var controllerTypes = []string{"megaraid", "cciss", "areca"}
+
+// Device identifies a device to query: its path and, when not auto-detected,
+// its smartctl device type (-d), e.g. "sat" or "megaraid,3".
+type Device struct {
+	Path string
+	Type string
+}
+
+// ControllerMember returns the RAID controller and member the device type
+// refers to, e.g. "megaraid" and "3" for "sat+megaraid,3".
+func (d Device) ControllerMember() (controller, member string) {
+	return parseControllerMember(d.Type)
+}
+
+// ID uniquely identifies the device: disks behind the same RAID controller
+// share their path and differ by member, e.g. "/dev/sda:megaraid,3".
+func (d Device) ID() string {
+	return deviceID(d.Path, d.Type)
+}
+
+// IsControllerType returns true when smartctl reaches disks behind the RAID
+// controller type by member number.
+func IsControllerType(deviceType string) bool {
+	// Protocol of the member disks may be specified, as in "sat+megaraid"
+	if idx := strings.LastIndex(deviceType, "+"); idx >= 0 {
+		deviceType = deviceType[idx+1:]
+	}
+	for _, controller := range controllerTypes {
+		if deviceType == controller {
+			return true
+		}
+	}
+	return false
+}
+
+func parseControllerMember(deviceType string) (controller, member string) {
+	idx := strings.Index(deviceType, ",")
+	if idx < 0 || !IsControllerType(deviceType[:idx]) {
+		return "", ""
+	}
+	controller = deviceType[:idx]
+	if plus := strings.LastIndex(controller, "+"); plus >= 0 {
+		controller = controller[plus+1:]
+	}
+	return controller, deviceType[idx+1:]
+}
+
+func deviceID(path, deviceType string) string {
+	controller, member := parseControllerMember(deviceType)
+	if controller == "" {
+		return path
+	}
+	return path + ":" + controller + "," + member
+}
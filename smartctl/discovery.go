@@ -0,0 +1,97 @@
+package smartctl
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// ScannedDevice is a device reported by smartctl --scan-open.
+type ScannedDevice struct {
+	Name      string // /dev/xxx
+	InfoName  string // /dev/xxx [SAT]
+	Type      string // nvme, sat, megaraid,N
+	Protocol  string // NVMe, ATA, SCSI
+	OpenError string // set when smartctl failed to open the device
+}
+
+// Device returns the device to query. Members of a RAID controller share the
+// controller path, the device type telling them apart.
+func (d ScannedDevice) Device() Device {
+	dev := Device{Path: d.Name}
+	if controller, _ := parseControllerMember(d.Type); controller != "" {
+		dev.Type = d.Type
+	}
+	return dev
+}
+
+// ScanDevices lists the devices smartctl is able to detect on the host.
+func (c *Command) ScanDevices(ctx context.Context) ([]ScannedDevice, error) {
+	var out jsonScanOutput
+	if _, err := c.run(ctx, &out, "--scan-open", "--json=c"); err != nil {
+		return nil, err
+	}
+	return newScannedDevices(&out), nil
+}
+
+// NewScannedDevices decodes the JSON output of smartctl --scan-open.
+func NewScannedDevices(output []byte) ([]ScannedDevice, error) {
+	var out jsonScanOutput
+	if err := decodeOutput(output, &out); err != nil {
+		return nil, err
+	}
+	return newScannedDevices(&out), nil
+}
+
+func newScannedDevices(out *jsonScanOutput) []ScannedDevice {
+	var res []ScannedDevice
+	for _, dev := range out.Devices {
+		res = append(res, ScannedDevice(dev))
+	}
+	return res
+}
+
+// DeviceFilter selects scanned devices by name, using filepath.Match patterns.
+// A device is selected when it matches at least one Include pattern (or Include
+// is empty) and none of the Exclude patterns.
+type DeviceFilter struct {
+	Include []string
+	Exclude []string
+}
+
+func (f DeviceFilter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid device pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f DeviceFilter) Match(name string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name)
+}
+
+func (f DeviceFilter) Filter(devices []ScannedDevice) []ScannedDevice {
+	var out []ScannedDevice
+	for _, dev := range devices {
+		if f.Match(dev.Name) {
+			out = append(out, dev)
+		}
+	}
+	return out
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
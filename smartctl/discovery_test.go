@@ -0,0 +1,93 @@
+package smartctl
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScannedDevices(t *testing.T) {
+	output, err := os.ReadFile("testdata/smartctl-scan-open.json")
+	require.NoError(t, err)
+	devices, err := NewScannedDevices(output)
+	require.NoError(t, err)
+
+	expected := []ScannedDevice{
+		{Name: "/dev/sda", InfoName: "/dev/sda [SAT]", Type: "sat", Protocol: "ATA"},
+		{Name: "/dev/sdb", InfoName: "/dev/sdb [SAT]", Type: "sat", Protocol: "ATA"},
+		{Name: "/dev/sdc", InfoName: "/dev/sdc [SAT]", Type: "sat", Protocol: "ATA"},
+		{Name: "/dev/sdd", InfoName: "/dev/sdd", Type: "scsi", Protocol: "SCSI", OpenError: "INQUIRY failed"},
+		{Name: "/dev/bus/0", InfoName: "/dev/bus/0 [megaraid_disk_00]", Type: "megaraid,0", Protocol: "SCSI"},
+		{Name: "/dev/bus/0", InfoName: "/dev/bus/0 [megaraid_disk_01] [SAT]", Type: "sat+megaraid,1", Protocol: "ATA"},
+		{Name: "/dev/nvme0", InfoName: "/dev/nvme0", Type: "nvme", Protocol: "NVMe"},
+	}
+	require.Equal(t, expected, devices)
+
+	require.Equal(t, Device{Path: "/dev/sda"}, expected[0].Device())
+	require.Equal(t, Device{Path: "/dev/bus/0", Type: "sat+megaraid,1"}, expected[5].Device())
+}
+
+func TestDeviceFilter(t *testing.T) {
+	devices := []ScannedDevice{
+		{Name: "/dev/sda"},
+		{Name: "/dev/sdb"},
+		{Name: "/dev/nvme0"},
+	}
+
+	t.Run("should select everything without patterns", func(t *testing.T) {
+		require.Equal(t, devices, DeviceFilter{}.Filter(devices))
+	})
+
+	t.Run("should apply include then exclude patterns", func(t *testing.T) {
+		f := DeviceFilter{
+			Include: []string{"/dev/sd*", "/dev/nvme*"},
+			Exclude: []string{"/dev/sda"},
+		}
+		require.Equal(t, []ScannedDevice{{Name: "/dev/sdb"}, {Name: "/dev/nvme0"}}, f.Filter(devices))
+	})
+
+	t.Run("should reject invalid patterns", func(t *testing.T) {
+		require.NoError(t, DeviceFilter{Include: []string{"/dev/sd[a-c]"}}.Validate())
+		require.Error(t, DeviceFilter{Exclude: []string{"/dev/sd["}}.Validate())
+	})
+}
+
+func TestDevice(t *testing.T) {
+	for _, tc := range []struct {
+		dev        Device
+		controller string
+		member     string
+		id         string
+	}{
+		{Device{Path: "/dev/sda"}, "", "", "/dev/sda"},
+		{Device{Path: "/dev/sda", Type: "sat"}, "", "", "/dev/sda"},
+		{Device{Path: "/dev/sda", Type: "megaraid,3"}, "megaraid", "3", "/dev/sda:megaraid,3"},
+		{Device{Path: "/dev/bus/0", Type: "sat+megaraid,12"}, "megaraid", "12", "/dev/bus/0:megaraid,12"},
+		{Device{Path: "/dev/sg0", Type: "cciss,1"}, "cciss", "1", "/dev/sg0:cciss,1"},
+		{Device{Path: "/dev/sg2", Type: "areca,3/1"}, "areca", "3/1", "/dev/sg2:areca,3/1"},
+		{Device{Path: "/dev/sda", Type: "usbjmicron,0"}, "", "", "/dev/sda"},
+	} {
+		controller, member := tc.dev.ControllerMember()
+		require.Equal(t, tc.controller, controller, tc.dev.Type)
+		require.Equal(t, tc.member, member, tc.dev.Type)
+		require.Equal(t, tc.id, tc.dev.ID(), tc.dev.Type)
+	}
+
+	require.True(t, IsControllerType("megaraid"))
+	require.True(t, IsControllerType("sat+cciss"))
+	require.False(t, IsControllerType("sat"))
+}
+
+func TestDeviceArgs(t *testing.T) {
+	require.Equal(t, []string{"/dev/sda"}, deviceArgs(Device{Path: "/dev/sda"}))
+	require.Equal(t, []string{"-d", "megaraid,3", "/dev/sda"}, deviceArgs(Device{Path: "/dev/sda", Type: "megaraid,3"}))
+}
+
+func TestDeviceInfo_ControllerMember(t *testing.T) {
+	raw := decodeJSON(t, `{"device": {"name": "/dev/bus/0", "info_name": "/dev/bus/0 [megaraid_disk_01] [SAT]", "type": "sat+megaraid,1", "protocol": "ATA"}}`)
+	info := extractDeviceInfo(raw)
+	require.Equal(t, "megaraid", info.Controller)
+	require.Equal(t, "1", info.ControllerMember)
+	require.Equal(t, "/dev/bus/0:megaraid,1", info.ID())
+}
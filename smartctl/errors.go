@@ -0,0 +1,151 @@
+package smartctl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Error classes of failed queries, matched with errors.Is.
+var (
+	ErrPermissionDenied    = errors.New("permission denied")
+	ErrNoSuchDevice        = errors.New("no such device")
+	ErrUnknownUSBBridge    = errors.New("unknown USB bridge")
+	ErrTimeout             = errors.New("timeout")
+	ErrUnsupportedProtocol = errors.New("unsupported protocol")
+)
+
+// ErrorClassOther is the class of errors matching none of the known classes.
+const ErrorClassOther = "other"
+
+var errorClasses = []struct {
+	name string
+	err  error
+	// lower-cased smartctl messages or standard error substrings
+	patterns []string
+}{
+	{"permission_denied", ErrPermissionDenied, []string{"permission denied", "operation not permitted", "password is required"}},
+	{"no_such_device", ErrNoSuchDevice, []string{"no such device", "no such file or directory"}},
+	{"unknown_usb_bridge", ErrUnknownUSBBridge, []string{"unknown usb bridge"}},
+	{"timeout", ErrTimeout, nil},
+	{"unsupported_protocol", ErrUnsupportedProtocol, []string{"unable to detect device type", "unknown device type", "requires option '-d", "device type not supported", "unsupported device type"}},
+}
+
+// ErrorClass returns the class name of a query error, e.g. "permission_denied",
+// ErrorClassOther when unknown and empty when err is nil.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, class := range errorClasses {
+		if errors.Is(err, class.err) {
+			return class.name
+		}
+	}
+	return ErrorClassOther
+}
+
+// ErrorClasses returns the names of all the error classes, ErrorClassOther
+// included.
+func ErrorClasses() []string {
+	names := make([]string, 0, len(errorClasses)+1)
+	for _, class := range errorClasses {
+		names = append(names, class.name)
+	}
+	return append(names, ErrorClassOther)
+}
+
+func errorClassByName(name string) error {
+	for _, class := range errorClasses {
+		if class.name == name {
+			return class.err
+		}
+	}
+	return nil
+}
+
+// Message is a message reported by smartctl, with its severity (information,
+// warning or error).
+type Message struct {
+	Text     string
+	Severity string
+}
+
+// QueryError is returned by failed device queries. errors.Is matches its
+// class, e.g. ErrPermissionDenied, as well as the underlying error.
+type QueryError struct {
+	Device     Device
+	ExitStatus ExitStatus
+	Messages   []Message
+	Err        error
+	class      error // nil when unknown
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the class of the error. The underlying error, e.g. one wrapping
+// ErrUnsupportedProtocol, is matched through Unwrap.
+func (e *QueryError) Is(target error) bool {
+	return e.class != nil && e.class == target
+}
+
+// newQueryError classifies err using the smartctl messages and the raw
+// process output, e.g. standard error.
+func newQueryError(err error, status ExitStatus, messages []jsonMessage, output []byte) *QueryError {
+	qe := &QueryError{
+		ExitStatus: status,
+		Err:        err,
+	}
+	var texts []string
+	for _, msg := range messages {
+		qe.Messages = append(qe.Messages, Message{Text: msg.String, Severity: msg.Severity})
+		texts = append(texts, strings.ToLower(msg.String))
+	}
+	if len(output) > 0 {
+		texts = append(texts, strings.ToLower(string(output)))
+	}
+	qe.class = classifyError(err, texts)
+	return qe
+}
+
+func classifyError(err error, texts []string) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrTimeout
+	}
+	// Errors created by the package wrap their class
+	for _, class := range errorClasses {
+		if errors.Is(err, class.err) {
+			return class.err
+		}
+	}
+	for _, class := range errorClasses {
+		for _, pattern := range class.patterns {
+			for _, text := range texts {
+				if strings.Contains(text, pattern) {
+					return class.err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// withDevice returns the query error of the device.
+func withDevice(device Device, err error) error {
+	if err == nil {
+		return nil
+	}
+	qe, ok := err.(*QueryError)
+	if !ok {
+		qe = newQueryError(err, 0, nil, nil)
+	}
+	qe.Device = device
+	return qe
+}
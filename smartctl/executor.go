@@ -0,0 +1,90 @@
+package smartctl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Executor builds the command line running smartctl, e.g. through a privilege
+// escalation tool.
+type Executor interface {
+	CommandLine(binary string, args []string) []string
+}
+
+// Executor types, as selected in the configuration.
+const (
+	ExecutorDirect  = "direct"
+	ExecutorSudo    = "sudo"
+	ExecutorDoas    = "doas"
+	ExecutorNsenter = "nsenter"
+	ExecutorPrefix  = "prefix"
+)
+
+// DirectExecutor runs smartctl as is.
+type DirectExecutor struct{}
+
+func (DirectExecutor) CommandLine(binary string, args []string) []string {
+	return append([]string{binary}, args...)
+}
+
+// SudoExecutor runs smartctl through sudo, failing instead of prompting for a
+// password.
+type SudoExecutor struct{}
+
+func (SudoExecutor) CommandLine(binary string, args []string) []string {
+	return PrefixExecutor{"sudo", "-n"}.CommandLine(binary, args)
+}
+
+// DoasExecutor runs smartctl through doas, failing instead of prompting for a
+// password.
+type DoasExecutor struct{}
+
+func (DoasExecutor) CommandLine(binary string, args []string) []string {
+	return PrefixExecutor{"doas", "-n"}.CommandLine(binary, args)
+}
+
+// NsenterExecutor runs smartctl in the mount namespace of the target process,
+// e.g. PID 1 to reach the host devices from a container.
+type NsenterExecutor struct {
+	TargetPID int
+}
+
+func (e NsenterExecutor) CommandLine(binary string, args []string) []string {
+	return PrefixExecutor{"nsenter", "-t", strconv.Itoa(e.TargetPID), "-m", "--"}.CommandLine(binary, args)
+}
+
+// PrefixExecutor runs smartctl as the argument of another command, e.g. an
+// audited wrapper script.
+type PrefixExecutor []string
+
+func (e PrefixExecutor) CommandLine(binary string, args []string) []string {
+	out := make([]string, 0, len(e)+1+len(args))
+	out = append(out, e...)
+	out = append(out, binary)
+	return append(out, args...)
+}
+
+// NewExecutor returns the executor of the given type, direct when empty.
+// targetPID applies to nsenter, prefix to the prefix executor.
+func NewExecutor(executorType string, targetPID int, prefix []string) (Executor, error) {
+	switch executorType {
+	case "", ExecutorDirect:
+		return DirectExecutor{}, nil
+	case ExecutorSudo:
+		return SudoExecutor{}, nil
+	case ExecutorDoas:
+		return DoasExecutor{}, nil
+	case ExecutorNsenter:
+		if targetPID <= 0 {
+			targetPID = 1
+		}
+		return NsenterExecutor{TargetPID: targetPID}, nil
+	case ExecutorPrefix:
+		if len(prefix) == 0 || prefix[0] == "" {
+			return nil, errors.New("prefix executor requires a command")
+		}
+		return PrefixExecutor(prefix), nil
+	}
+	return nil, fmt.Errorf("unsupported executor %q, expected direct, sudo, doas, nsenter or prefix", executorType)
+}
@@ -0,0 +1,40 @@
+package smartctl
+
+// ExitStatus is the smartctl exit status bitmask, as described in the
+// RETURN VALUES section of smartctl(8).
+type ExitStatus int
+
+const (
+	// ExitCommandLineError reports that the command line did not parse.
+	ExitCommandLineError ExitStatus = 1 << iota
+	// ExitDeviceOpenFailed reports that the device could not be opened.
+	ExitDeviceOpenFailed
+	// ExitSMARTCommandFailed reports that a SMART or other command to the disk
+	// failed, or that a checksum error occurred in a SMART data structure.
+	ExitSMARTCommandFailed
+	// ExitDiskFailing reports that the SMART status check returned "DISK FAILING".
+	ExitDiskFailing
+	// ExitPrefailBelowThreshold reports prefail attributes <= threshold.
+	ExitPrefailBelowThreshold
+	// ExitBelowThresholdInPast reports attributes that have been <= threshold
+	// at some time in the past.
+	ExitBelowThresholdInPast
+	// ExitErrorLogHasErrors reports that the device error log contains errors.
+	ExitErrorLogHasErrors
+	// ExitSelfTestLogHasErrors reports that the self-test log contains errors.
+	ExitSelfTestLogHasErrors
+)
+
+// fatalExitStatus are the bits for which smartctl output cannot be trusted.
+// Other bits report disk conditions and come with valid output.
+const fatalExitStatus = ExitCommandLineError | ExitDeviceOpenFailed
+
+// Has returns true when all the bits of flag are set.
+func (s ExitStatus) Has(flag ExitStatus) bool {
+	return s&flag == flag
+}
+
+// Fatal returns true when smartctl failed to query the device.
+func (s ExitStatus) Fatal() bool {
+	return s&fatalExitStatus != 0
+}
@@ -0,0 +1,301 @@
+package smartctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// helperRequestTimeout bounds the time a client takes to send its request.
+	helperRequestTimeout = 5 * time.Second
+	// helperMaxRequestSize bounds the request read from a client, the helper
+	// running as root.
+	helperMaxRequestSize = 64 << 10
+
+	// helperSocketMode lets the socket group, e.g. the daemon group, connect
+	// to the helper.
+	helperSocketMode = 0o660
+	// helperSocketDirMode applies to the socket directory, when created.
+	helperSocketDirMode = 0o750
+
+	// helperResponseMargin is the time the helper gets to answer beyond the
+	// smartctl timeout: terminating smartctl, reading its outputs and sending
+	// the response.
+	helperResponseMargin = killGracePeriod + outputDrainTimeout + 2*time.Second
+)
+
+// HelperRequest is the only request the helper accepts: querying a device
+// with the settings of a profile.
+type HelperRequest struct {
+	Device  Device `json:"device"`
+	Profile string `json:"profile"`
+}
+
+type helperResponse struct {
+	Data  *Data  `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Details of query errors, see QueryError
+	ErrorClass string     `json:"error_class,omitempty"`
+	ExitStatus ExitStatus `json:"exit_status,omitempty"`
+	Messages   []Message  `json:"messages,omitempty"`
+}
+
+type helperKey struct {
+	device  Device
+	profile string
+}
+
+// Helper queries devices on behalf of an unprivileged process, over a Unix
+// socket. It only queries the devices it allows, using its own commands: the
+// client never chooses smartctl arguments.
+type Helper struct {
+	commands map[helperKey]*Command
+}
+
+func NewHelper() *Helper {
+	return &Helper{
+		commands: make(map[helperKey]*Command),
+	}
+}
+
+// Allow lets clients query the device with the profile, using the command.
+func (h *Helper) Allow(device Device, profile string, cmd *Command) error {
+	if err := ValidateDevice(device); err != nil {
+		return err
+	}
+	h.commands[helperKey{device: device, profile: profile}] = cmd
+	return nil
+}
+
+// Serve answers the requests received on the listener until the context is
+// done.
+func (h *Helper) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var running sync.WaitGroup
+	defer running.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			h.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (h *Helper) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	var req HelperRequest
+	_ = conn.SetReadDeadline(time.Now().Add(helperRequestTimeout))
+	if err := json.NewDecoder(io.LimitReader(conn, helperMaxRequestSize)).Decode(&req); err != nil {
+		_ = json.NewEncoder(conn).Encode(helperResponse{Error: fmt.Sprintf("invalid request: %s", err)})
+		return
+	}
+
+	var resp helperResponse
+	data, err := h.query(ctx, req)
+	if err != nil {
+		resp.Error = err.Error()
+		resp.ErrorClass = ErrorClass(err)
+		var qe *QueryError
+		if errors.As(err, &qe) {
+			resp.ExitStatus = qe.ExitStatus
+			resp.Messages = qe.Messages
+		}
+	} else {
+		resp.Data = &data
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(helperRequestTimeout))
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+func (h *Helper) query(ctx context.Context, req HelperRequest) (Data, error) {
+	if err := ValidateDevice(req.Device); err != nil {
+		return Data{}, err
+	}
+	cmd, ok := h.commands[helperKey{device: req.Device, profile: req.Profile}]
+	if !ok {
+		return Data{}, fmt.Errorf("device %s with profile %q is not allowed", req.Device.ID(), req.Profile)
+	}
+	return cmd.QueryDevice(ctx, req.Device)
+}
+
+// ListenHelper listens on the Unix socket, replacing a stale one. The socket
+// and its directory, when created, belong to group (name or ID) so that its
+// members can connect to the helper. group is optional, the socket then
+// belonging to the group of the process.
+func ListenHelper(socket string, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		var err error
+		if gid, err = lookupGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := filepath.Dir(socket)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, helperSocketDirMode); err != nil {
+			return nil, fmt.Errorf("creating socket directory: %w", err)
+		}
+		// MkdirAll is subject to the umask
+		if err := os.Chmod(dir, helperSocketDirMode); err != nil {
+			return nil, fmt.Errorf("setting socket directory permissions: %w", err)
+		}
+		if err := os.Chown(dir, -1, gid); err != nil {
+			return nil, fmt.Errorf("setting socket directory group: %w", err)
+		}
+	}
+
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, helperSocketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("setting socket permissions: %w", err)
+	}
+	if err := os.Chown(socket, -1, gid); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("setting socket group: %w", err)
+	}
+	return listener, nil
+}
+
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// deviceTypeRegexp matches smartctl -d values, as in "sat+megaraid,3" or
+// "areca,3/1".
+var deviceTypeRegexp = regexp.MustCompile(`^[a-zA-Z0-9_+,/]*$`)
+
+// ValidateDevice rejects device paths and types which smartctl could take for
+// options, or which are not clean absolute paths.
+func ValidateDevice(device Device) error {
+	path := device.Path
+	switch {
+	case path == "":
+		return errors.New("device path is empty")
+	case strings.HasPrefix(path, "-"):
+		return fmt.Errorf("device path %q must not start with -", path)
+	case !filepath.IsAbs(path) || filepath.Clean(path) != path:
+		return fmt.Errorf("device path %q must be a clean absolute path", path)
+	case !deviceTypeRegexp.MatchString(device.Type):
+		return fmt.Errorf("invalid device type %q", device.Type)
+	}
+	return nil
+}
+
+// HelperClient queries devices through a Helper, the same way Command does.
+type HelperClient struct {
+	socket         string
+	profile        string
+	dialTimeout    time.Duration
+	requestTimeout time.Duration
+}
+
+// NewHelperClient returns a client querying devices with the given profile,
+// through the helper listening on socket. timeout is the smartctl timeout of
+// the profile, DefaultCommandTimeout when zero.
+func NewHelperClient(socket string, profile string, timeout time.Duration) *HelperClient {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	return &HelperClient{
+		socket:         socket,
+		profile:        profile,
+		dialTimeout:    DefaultCommandTimeout,
+		requestTimeout: timeout + helperResponseMargin,
+	}
+}
+
+// QueryDevice asks the helper to query the device. The context bounds the
+// whole query, waiting for the helper limiter included, as does the smartctl
+// timeout plus a margin. Errors are QueryError, classified by the helper.
+func (c *HelperClient) QueryDevice(ctx context.Context, device Device) (Data, error) {
+	data, err := c.queryDevice(ctx, device)
+	return data, withDevice(device, err)
+}
+
+func (c *HelperClient) queryDevice(ctx context.Context, device Device) (Data, error) {
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, c.dialTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "unix", c.socket)
+	if err != nil {
+		return Data{}, fmt.Errorf("connecting to helper: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.requestTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblocks reading the response
+			_ = conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	if err := json.NewEncoder(conn).Encode(HelperRequest{Device: device, Profile: c.profile}); err != nil {
+		return Data{}, fmt.Errorf("sending request to helper: %w", err)
+	}
+	var resp helperResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return Data{}, fmt.Errorf("reading helper response: %w", err)
+	}
+	if resp.Error != "" {
+		return Data{}, &QueryError{
+			ExitStatus: resp.ExitStatus,
+			Messages:   resp.Messages,
+			Err:        fmt.Errorf("helper: %s", resp.Error),
+			class:      errorClassByName(resp.ErrorClass),
+		}
+	}
+	if resp.Data == nil {
+		return Data{}, errors.New("helper: empty response")
+	}
+	return *resp.Data, nil
+}
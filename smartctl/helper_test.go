@@ -0,0 +1,185 @@
+package smartctl
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelper(t *testing.T) {
+	testfile, err := filepath.Abs("testdata/smartctl-output-nvme.json")
+	require.NoError(t, err)
+	device := Device{Path: testfile}
+
+	permfile, err := filepath.Abs("testdata/smartctl-output-error-perm.json")
+	require.NoError(t, err)
+
+	cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"))
+	helper := NewHelper()
+	require.NoError(t, helper.Allow(device, "nvme", cmd))
+	require.NoError(t, helper.Allow(Device{Path: permfile}, "", cmd))
+	require.EqualError(t, helper.Allow(Device{Path: "-d"}, "", cmd), `device path "-d" must not start with -`)
+
+	socket := filepath.Join(t.TempDir(), "helper.sock")
+	listener, err := ListenHelper(socket, "")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- helper.Serve(ctx, listener)
+	}()
+
+	t.Run("should query allowed devices", func(t *testing.T) {
+		expected, err := cmd.QueryDevice(context.Background(), device)
+		require.NoError(t, err)
+		data, err := NewHelperClient(socket, "nvme", 0).QueryDevice(context.Background(), device)
+		require.NoError(t, err)
+		data.Invocation, expected.Invocation = Invocation{}, Invocation{}
+		require.Equal(t, expected, data)
+	})
+
+	t.Run("should reject other devices and profiles", func(t *testing.T) {
+		_, err := NewHelperClient(socket, "ata", 0).QueryDevice(context.Background(), device)
+		require.EqualError(t, err, `helper: device `+testfile+` with profile "ata" is not allowed`)
+
+		_, err = NewHelperClient(socket, "nvme", 0).QueryDevice(context.Background(), Device{Path: testfile, Type: "sat"})
+		require.EqualError(t, err, `helper: device `+testfile+` with profile "nvme" is not allowed`)
+
+		_, err = NewHelperClient(socket, "nvme", 0).QueryDevice(context.Background(), Device{Path: "--scan"})
+		require.EqualError(t, err, `helper: device path "--scan" must not start with -`)
+	})
+
+	t.Run("should report classified query errors", func(t *testing.T) {
+		_, err := NewHelperClient(socket, "", 0).QueryDevice(context.Background(), Device{Path: permfile})
+		require.ErrorIs(t, err, ErrPermissionDenied)
+		var qe *QueryError
+		require.ErrorAs(t, err, &qe)
+		require.Equal(t, Device{Path: permfile}, qe.Device)
+		require.Equal(t, ExitDeviceOpenFailed, qe.ExitStatus)
+		require.Len(t, qe.Messages, 1)
+	})
+
+	t.Run("should reject oversized requests", func(t *testing.T) {
+		conn, err := net.Dial("unix", socket)
+		require.NoError(t, err)
+		defer conn.Close()
+		go func() {
+			_, _ = conn.Write([]byte(`{"profile":"` + strings.Repeat("a", 2*helperMaxRequestSize) + `"}`))
+		}()
+		var resp helperResponse
+		require.NoError(t, json.NewDecoder(conn).Decode(&resp))
+		require.Contains(t, resp.Error, "invalid request")
+	})
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestListenHelper(t *testing.T) {
+	group, err := user.LookupGroupId(strconv.Itoa(os.Getgid()))
+	require.NoError(t, err)
+
+	t.Run("should create the socket directory and set the socket group", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "run", "helper.sock")
+		for i := 0; i < 2; i++ {
+			// The second time, replaces the stale socket
+			listener, err := ListenHelper(socket, group.Name)
+			require.NoError(t, err)
+			listener.(*net.UnixListener).SetUnlinkOnClose(false)
+			defer listener.Close()
+		}
+
+		info, err := os.Stat(filepath.Dir(socket))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(helperSocketDirMode), info.Mode().Perm())
+		require.Equal(t, group.Gid, strconv.Itoa(int(info.Sys().(*syscall.Stat_t).Gid)))
+
+		info, err = os.Stat(socket)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(helperSocketMode), info.Mode().Perm())
+		require.Equal(t, group.Gid, strconv.Itoa(int(info.Sys().(*syscall.Stat_t).Gid)))
+	})
+
+	t.Run("should accept group IDs", func(t *testing.T) {
+		listener, err := ListenHelper(filepath.Join(t.TempDir(), "helper.sock"), group.Gid)
+		require.NoError(t, err)
+		listener.Close()
+	})
+
+	t.Run("should fail on unknown groups", func(t *testing.T) {
+		_, err := ListenHelper(filepath.Join(t.TempDir(), "helper.sock"), "no-such-group-datadog-smartctl")
+		require.Error(t, err)
+	})
+}
+
+func TestValidateDevice(t *testing.T) {
+	for _, device := range []Device{
+		{Path: "/dev/sda"},
+		{Path: "/dev/bus/0", Type: "sat+megaraid,3"},
+		{Path: "/dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000000"},
+	} {
+		require.NoError(t, ValidateDevice(device), device.ID())
+	}
+	for _, device := range []Device{
+		{},
+		{Path: "-a"},
+		{Path: "dev/sda"},
+		{Path: "/dev/../etc/shadow"},
+	} {
+		require.Error(t, ValidateDevice(device), device.ID())
+	}
+
+	for deviceType, valid := range map[string]bool{
+		"":                true,
+		"sat":             true,
+		"nvme,0x1":        true,
+		"nvme,0xFFFFFFFF": true,
+		"areca,3/1":       true,
+		"cciss,12":        true,
+		"usbjmicron,p,0":  true,
+		"sat,auto,12":     true,
+		"-x":              false,
+		"sat /dev/sdb":    false,
+		"sat;reboot":      false,
+		"sat\n-x":         false,
+		"$(reboot)":       false,
+	} {
+		err := ValidateDevice(Device{Path: "/dev/sda", Type: deviceType})
+		if valid {
+			require.NoError(t, err, deviceType)
+		} else {
+			require.Error(t, err, deviceType)
+		}
+	}
+}
+
+func TestHelperClient_Timeout(t *testing.T) {
+	// The helper accepts the connection, but never answers
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "helper.sock"))
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	client := NewHelperClient(listener.Addr().String(), "", 0)
+	client.requestTimeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err = client.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+	require.ErrorIs(t, err, ErrTimeout)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,177 @@
+package smartctl
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupBy selects the devices which cannot be queried at the same time.
+type GroupBy string
+
+const (
+	GroupByNone GroupBy = ""
+	// GroupByController serializes the queries of the members of a RAID
+	// controller.
+	GroupByController GroupBy = "controller"
+	// GroupByHost serializes the queries of the devices attached to the same
+	// SCSI host (HBA or SATA controller), RAID controller members included.
+	GroupByHost GroupBy = "host"
+)
+
+func (g GroupBy) Valid() bool {
+	switch g {
+	case GroupByNone, GroupByController, GroupByHost:
+		return true
+	}
+	return false
+}
+
+// sysfsRoot is where the device topology is read from, changed by tests.
+var sysfsRoot = "/sys"
+
+// LimiterStats is a snapshot of the queries going through a Limiter.
+type LimiterStats struct {
+	InFlight int // queries running
+	Waiting  int // queries waiting for their turn
+}
+
+// Limiter bounds the number of smartctl queries running at the same time,
+// optionally running a single query at a time per group of devices. It is
+// shared by the commands of all the devices. A nil Limiter does not limit
+// anything.
+type Limiter struct {
+	slots   chan struct{} // nil when the number of queries is not bounded
+	groupBy GroupBy
+
+	mu     sync.Mutex
+	groups map[string]chan struct{}
+	stats  LimiterStats
+}
+
+// NewLimiter returns a limiter running at most maxParallel queries at once,
+// unbounded when 0.
+func NewLimiter(maxParallel int, groupBy GroupBy) *Limiter {
+	l := &Limiter{
+		groupBy: groupBy,
+		groups:  make(map[string]chan struct{}),
+	}
+	if maxParallel > 0 {
+		l.slots = make(chan struct{}, maxParallel)
+	}
+	return l
+}
+
+// Acquire waits for the device turn, returning the function to call once the
+// query completes and how long it waited.
+func (l *Limiter) Acquire(ctx context.Context, device Device) (func(), time.Duration, error) {
+	if l == nil {
+		return func() {}, 0, nil
+	}
+
+	start := time.Now()
+	l.update(func(s *LimiterStats) { s.Waiting++ })
+
+	// Wait for the group first, not to hold a global slot meanwhile
+	var group chan struct{}
+	if key := l.groupKey(device); key != "" {
+		group = l.group(key)
+		select {
+		case group <- struct{}{}:
+		case <-ctx.Done():
+			l.update(func(s *LimiterStats) { s.Waiting-- })
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			if group != nil {
+				<-group
+			}
+			l.update(func(s *LimiterStats) { s.Waiting-- })
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+
+	l.update(func(s *LimiterStats) {
+		s.Waiting--
+		s.InFlight++
+	})
+	release := func() {
+		l.update(func(s *LimiterStats) { s.InFlight-- })
+		if l.slots != nil {
+			<-l.slots
+		}
+		if group != nil {
+			<-group
+		}
+	}
+	return release, time.Since(start), nil
+}
+
+func (l *Limiter) Stats() LimiterStats {
+	if l == nil {
+		return LimiterStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *Limiter) update(change func(*LimiterStats)) {
+	l.mu.Lock()
+	change(&l.stats)
+	l.mu.Unlock()
+}
+
+func (l *Limiter) group(key string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	group, ok := l.groups[key]
+	if !ok {
+		group = make(chan struct{}, 1)
+		l.groups[key] = group
+	}
+	return group
+}
+
+// groupKey returns the group of the device, empty when it is not part of any.
+func (l *Limiter) groupKey(device Device) string {
+	if l.groupBy == GroupByHost {
+		if host := scsiHost(device.Path); host != "" {
+			return "host:" + host
+		}
+	}
+	if l.groupBy == GroupByController || l.groupBy == GroupByHost {
+		if controller, _ := device.ControllerMember(); controller != "" {
+			return "controller:" + device.Path
+		}
+	}
+	return ""
+}
+
+// scsiHost returns the SCSI host of a block or SCSI generic device, e.g.
+// host0, empty when unknown (e.g. NVMe devices).
+func scsiHost(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	name := filepath.Base(path)
+	for _, class := range []string{"block", "scsi_generic"} {
+		target, err := filepath.EvalSymlinks(filepath.Join(sysfsRoot, "class", class, name, "device"))
+		if err != nil {
+			continue
+		}
+		// Example: /sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0
+		for _, part := range strings.Split(target, string(filepath.Separator)) {
+			if strings.HasPrefix(part, "host") {
+				return part
+			}
+		}
+	}
+	return ""
+}
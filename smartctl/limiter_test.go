@@ -0,0 +1,148 @@
+package smartctl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("should bound parallel queries", func(t *testing.T) {
+		l := NewLimiter(2, GroupByNone)
+		var releases []func()
+		for _, path := range []string{"/dev/sda", "/dev/sdb"} {
+			release, _, err := l.Acquire(context.Background(), Device{Path: path})
+			require.NoError(t, err)
+			releases = append(releases, release)
+		}
+		require.Equal(t, LimiterStats{InFlight: 2}, l.Stats())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, wait, err := l.Acquire(ctx, Device{Path: "/dev/sdc"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.GreaterOrEqual(t, wait, 20*time.Millisecond)
+
+		acquired := make(chan time.Duration)
+		go func() {
+			release, wait, _ := l.Acquire(context.Background(), Device{Path: "/dev/sdc"})
+			release()
+			acquired <- wait
+		}()
+		require.Eventually(t, func() bool { return l.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		releases[0]()
+		require.GreaterOrEqual(t, <-acquired, 10*time.Millisecond)
+
+		releases[1]()
+		require.Equal(t, LimiterStats{}, l.Stats())
+	})
+
+	t.Run("should serialize queries of RAID controller members", func(t *testing.T) {
+		l := NewLimiter(0, GroupByController)
+		release, _, err := l.Acquire(context.Background(), Device{Path: "/dev/bus/0", Type: "megaraid,0"})
+		require.NoError(t, err)
+
+		// Other devices are not limited
+		other, _, err := l.Acquire(context.Background(), Device{Path: "/dev/sda"})
+		require.NoError(t, err)
+		other()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err = l.Acquire(ctx, Device{Path: "/dev/bus/0", Type: "megaraid,1"})
+		require.Error(t, err)
+
+		release()
+		release, _, err = l.Acquire(context.Background(), Device{Path: "/dev/bus/0", Type: "megaraid,1"})
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("should serialize queries of devices sharing a SCSI host", func(t *testing.T) {
+		root := t.TempDir()
+		devices := filepath.Join(root, "devices/pci0000:00/0000:00:17.0")
+		for name, target := range map[string]string{
+			"sda": "ata1/host0/target0:0:0/0:0:0:0",
+			"sdb": "ata2/host1/target1:0:0/1:0:0:0",
+			"sdc": "ata1/host0/target0:1:0/0:1:0:0",
+		} {
+			require.NoError(t, os.MkdirAll(filepath.Join(devices, target), 0o755))
+			require.NoError(t, os.MkdirAll(filepath.Join(root, "class/block", name), 0o755))
+			require.NoError(t, os.Symlink(filepath.Join(devices, target), filepath.Join(root, "class/block", name, "device")))
+		}
+		defer func(previous string) { sysfsRoot = previous }(sysfsRoot)
+		sysfsRoot = root
+
+		require.Equal(t, "host0", scsiHost("/dev/sda"))
+		require.Equal(t, "host1", scsiHost("/dev/sdb"))
+		require.Equal(t, "", scsiHost("/dev/nvme0"))
+
+		l := NewLimiter(0, GroupByHost)
+		release, _, err := l.Acquire(context.Background(), Device{Path: "/dev/sda"})
+		require.NoError(t, err)
+		other, _, err := l.Acquire(context.Background(), Device{Path: "/dev/sdb"})
+		require.NoError(t, err)
+		other()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err = l.Acquire(ctx, Device{Path: "/dev/sdc"})
+		require.Error(t, err)
+		release()
+	})
+
+	t.Run("should not limit anything when nil", func(t *testing.T) {
+		var l *Limiter
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			release, wait, err := l.Acquire(context.Background(), Device{Path: "/dev/sda"})
+			require.NoError(t, err)
+			require.Zero(t, wait)
+			wg.Add(1)
+			go func() {
+				release()
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, LimiterStats{}, l.Stats())
+	})
+}
+
+func TestCommand_WithLimiter(t *testing.T) {
+	l := NewLimiter(1, GroupByNone)
+	release, _, err := l.Acquire(context.Background(), Device{Path: "/dev/sda"})
+	require.NoError(t, err)
+
+	cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"), WithLimiter(l))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	data, err := cmd.QueryDevice(context.Background(), Device{Path: "testdata/smartctl-output-nvme.json"})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, data.Invocation.QueueWait, 10*time.Millisecond)
+	require.Equal(t, LimiterStats{}, l.Stats())
+}
+
+func TestCommand_StartSelfTestWithLimiter(t *testing.T) {
+	l := NewLimiter(1, GroupByNone)
+	release, _, err := l.Acquire(context.Background(), Device{Path: "/dev/sda"})
+	require.NoError(t, err)
+
+	cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"), WithLimiter(l))
+	device := Device{Path: "testdata/smartctl-selftest-started.json"}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, cmd.StartSelfTest(ctx, device, SelfTestShort), context.DeadlineExceeded)
+
+	release()
+	require.NoError(t, cmd.StartSelfTest(context.Background(), device, SelfTestShort))
+	require.Equal(t, LimiterStats{}, l.Stats())
+}
@@ -0,0 +1,136 @@
+package smartctl
+
+// NVMeErrorInfoLog is the NVMe error information log (-l error).
+type NVMeErrorInfoLog struct {
+	Size    int // number of entries supported by the controller
+	Read    int // number of entries read from the controller
+	Unread  int // number of non-empty entries that were not read
+	Entries []NVMeErrorInfoEntry
+}
+
+type NVMeErrorInfoEntry struct {
+	ErrorCount        int // unique identifier of the error, incremented for each new error
+	SubmissionQueueID int
+	CommandID         int
+	StatusCodeType    int
+	StatusCode        int
+	Status            string // e.g. "Invalid Field in Command"
+	DoNotRetry        bool
+	LBA               int
+	NSID              int
+}
+
+// LastError returns the most recent entry, which has the highest error count.
+func (l NVMeErrorInfoLog) LastError() (NVMeErrorInfoEntry, bool) {
+	var last NVMeErrorInfoEntry
+	for _, entry := range l.Entries {
+		if entry.ErrorCount > last.ErrorCount {
+			last = entry
+		}
+	}
+	return last, last.ErrorCount > 0
+}
+
+// NVMeSelfTestLog is the NVMe self-test log (-l selftest, smartctl >= 7.3).
+type NVMeSelfTestLog struct {
+	CurrentOperation       int // 0 when no self-test is in progress
+	CurrentOperationString string
+	CompletionPercent      int
+	Entries                []NVMeSelfTestEntry // most recent first
+}
+
+// InProgress returns true when a self-test is running.
+func (l NVMeSelfTestLog) InProgress() bool {
+	return l.CurrentOperation != 0
+}
+
+// FailedCount returns the number of logged self-tests that failed.
+func (l NVMeSelfTestLog) FailedCount() int {
+	count := 0
+	for _, entry := range l.Entries {
+		if entry.Failed() {
+			count++
+		}
+	}
+	return count
+}
+
+// LastByType returns the most recent entry of each self-test type.
+func (l NVMeSelfTestLog) LastByType() []NVMeSelfTestEntry {
+	var out []NVMeSelfTestEntry
+	seen := make(map[int]bool)
+	for _, entry := range l.Entries {
+		if seen[entry.Code] {
+			continue
+		}
+		seen[entry.Code] = true
+		out = append(out, entry)
+	}
+	return out
+}
+
+type NVMeSelfTestEntry struct {
+	Code         int    // 1: short, 2: extended
+	Type         string // e.g. "Short"
+	Result       int
+	ResultString string // e.g. "Completed without error"
+	PowerOnHours int
+	LBA          int // first failing LBA, 0 if unknown
+}
+
+// Failed returns true when the self-test completed with errors: fatal error,
+// unknown failed segment or failed segments.
+func (e NVMeSelfTestEntry) Failed() bool {
+	return e.Result >= 5 && e.Result <= 7
+}
+
+func extractNVMeErrorInfoLog(out *jsonOutput) *NVMeErrorInfoLog {
+	log := out.NVMeErrorInformationLog
+	if log == nil {
+		return nil
+	}
+
+	res := &NVMeErrorInfoLog{
+		Size:   log.Size,
+		Read:   log.Read,
+		Unread: log.Unread,
+	}
+	for _, entry := range log.Table {
+		res.Entries = append(res.Entries, NVMeErrorInfoEntry{
+			ErrorCount:        entry.ErrorCount,
+			SubmissionQueueID: entry.SubmissionQueueID,
+			CommandID:         entry.CommandID,
+			StatusCodeType:    entry.StatusField.StatusCodeType,
+			StatusCode:        entry.StatusField.StatusCode,
+			Status:            entry.StatusField.String,
+			DoNotRetry:        entry.StatusField.DoNotRetry,
+			LBA:               entry.LBA.Value,
+			NSID:              entry.NSID,
+		})
+	}
+	return res
+}
+
+func extractNVMeSelfTestLog(out *jsonOutput) *NVMeSelfTestLog {
+	log := out.NVMeSelfTestLog
+	if log == nil {
+		return nil
+	}
+
+	res := &NVMeSelfTestLog{
+		CurrentOperation:       log.CurrentSelfTestOperation.Value,
+		CurrentOperationString: log.CurrentSelfTestOperation.String,
+		CompletionPercent:      log.CurrentSelfTestCompletionPercent,
+	}
+	for _, entry := range log.Table {
+		res.Entries = append(res.Entries, NVMeSelfTestEntry{
+			Code:         entry.SelfTestCode.Value,
+			Type:         entry.SelfTestCode.String,
+			Result:       entry.SelfTestResult.Value,
+			ResultString: entry.SelfTestResult.String,
+			PowerOnHours: entry.PowerOnHours,
+			LBA:          entry.LBA,
+		})
+	}
+	return res
+}
@@ -0,0 +1,352 @@
+package smartctl
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Typed smartctl JSON output (--json), limited to the fields used by the
+// package. Sections and fields smartctl may omit are pointers, nil when
+// missing.
+
+// smartctlOutput is implemented by all the smartctl outputs, which start with
+// the smartctl section.
+type smartctlOutput interface {
+	header() jsonSmartctl
+}
+
+type jsonHeader struct {
+	Smartctl jsonSmartctl `json:"smartctl"`
+}
+
+func (h jsonHeader) header() jsonSmartctl {
+	return h.Smartctl
+}
+
+type jsonSmartctl struct {
+	Version    []int         `json:"version"` // e.g. [7, 2]
+	ExitStatus int           `json:"exit_status"`
+	Messages   []jsonMessage `json:"messages"`
+}
+
+type jsonMessage struct {
+	String   string `json:"string"`
+	Severity string `json:"severity"`
+}
+
+type jsonVersionOutput struct {
+	jsonHeader
+	JSONFormatVersion []int `json:"json_format_version"`
+}
+
+type jsonOutput struct {
+	jsonHeader
+	Device          *jsonDevice `json:"device"`
+	ModelFamily     string      `json:"model_family"`
+	ModelName       string      `json:"model_name"`
+	SerialNumber    string      `json:"serial_number"`
+	FirmwareVersion string      `json:"firmware_version"`
+	UserCapacity    *struct {
+		Bytes int `json:"bytes"`
+	} `json:"user_capacity"`
+	RotationRate *int `json:"rotation_rate"`
+	FormFactor   *struct {
+		Name string `json:"name"`
+	} `json:"form_factor"`
+	WWN              *jsonWWN `json:"wwn"`
+	LogicalBlockSize int      `json:"logical_block_size"`
+	SATAVersion      *struct {
+		String string `json:"string"`
+	} `json:"sata_version"`
+	NVMePCIVendor *struct {
+		ID int `json:"id"`
+	} `json:"nvme_pci_vendor"`
+	NVMeTotalCapacity int `json:"nvme_total_capacity"`
+	SmartStatus       *struct {
+		Passed *bool `json:"passed"`
+	} `json:"smart_status"`
+	PowerOnTime *struct {
+		Hours *int `json:"hours"`
+	} `json:"power_on_time"`
+	Temperature *jsonTemperature `json:"temperature"`
+
+	ATASmartAttributes *struct {
+		Table []jsonATASmartAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	ATASmartData *struct {
+		SelfTest *struct {
+			Status *jsonSelfTestStatus `json:"status"`
+		} `json:"self_test"`
+	} `json:"ata_smart_data"`
+	ATADeviceStatistics *struct {
+		Pages []struct {
+			Table []struct {
+				Name  string `json:"name"`
+				Value int    `json:"value"`
+			} `json:"table"`
+		} `json:"pages"`
+	} `json:"ata_device_statistics"`
+	ATASmartSelfTestLog *struct {
+		Extended *jsonATASelfTestLog `json:"extended"`
+		Standard *jsonATASelfTestLog `json:"standard"`
+	} `json:"ata_smart_self_test_log"`
+	ATASmartErrorLog *struct {
+		Extended *jsonATAErrorLog `json:"extended"`
+		Summary  *jsonATAErrorLog `json:"summary"`
+	} `json:"ata_smart_error_log"`
+	ATASCTStatus             *jsonATASCTStatus             `json:"ata_sct_status"`
+	ATASCTTemperatureHistory *jsonATASCTTemperatureHistory `json:"ata_sct_temperature_history"`
+	SATAPhyEventCounters     *struct {
+		Table []jsonSATAPhyEventCounter `json:"table"`
+	} `json:"sata_phy_event_counters"`
+
+	NVMeSmartHealthInformationLog *jsonNVMeHealthInformation   `json:"nvme_smart_health_information_log"`
+	NVMeErrorInformationLog       *jsonNVMeErrorInformationLog `json:"nvme_error_information_log"`
+	NVMeSelfTestLog               *jsonNVMeSelfTestLog         `json:"nvme_self_test_log"`
+
+	SCSIGrownDefectList                  *int                           `json:"scsi_grown_defect_list"`
+	SCSIErrorCounterLog                  *jsonSCSIErrorCounterLog       `json:"scsi_error_counter_log"`
+	SCSIStartStopCycleCounter            *jsonSCSIStartStopCycleCounter `json:"scsi_start_stop_cycle_counter"`
+	SCSIPercentageUsedEnduranceIndicator *int                           `json:"scsi_percentage_used_endurance_indicator"`
+}
+
+type jsonDevice struct {
+	Name      string `json:"name"`
+	InfoName  string `json:"info_name"`
+	Type      string `json:"type"`
+	Protocol  string `json:"protocol"`
+	OpenError string `json:"open_error"`
+}
+
+// jsonWWN is the World Wide Name of a device, split in its NAA, IEEE OUI and
+// vendor specific ID.
+type jsonWWN struct {
+	NAA int `json:"naa"`
+	OUI int `json:"oui"`
+	ID  int `json:"id"`
+}
+
+type jsonScanOutput struct {
+	jsonHeader
+	Devices []jsonDevice `json:"devices"`
+}
+
+type jsonValueString struct {
+	Value  int    `json:"value"`
+	String string `json:"string"`
+}
+
+type jsonTemperature struct {
+	Current   *int `json:"current"`
+	DriveTrip int  `json:"drive_trip"`
+}
+
+type jsonATASmartAttribute struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Value      int    `json:"value"`
+	Worst      int    `json:"worst"`
+	Thresh     int    `json:"thresh"`
+	WhenFailed string `json:"when_failed"`
+	Flags      struct {
+		Value int `json:"value"`
+	} `json:"flags"`
+	Raw *jsonValueString `json:"raw"`
+}
+
+type jsonSelfTestStatus struct {
+	Value            int    `json:"value"`
+	String           string `json:"string"`
+	RemainingPercent int    `json:"remaining_percent"`
+}
+
+type jsonATASelfTestLog struct {
+	Count           int `json:"count"`
+	ErrorCountTotal int `json:"error_count_total"`
+	Table           []struct {
+		Type   jsonValueString `json:"type"`
+		Status struct {
+			Value  int    `json:"value"`
+			String string `json:"string"`
+			Passed *bool  `json:"passed"`
+		} `json:"status"`
+		LifetimeHours int `json:"lifetime_hours"`
+		LBA           int `json:"lba"`
+	} `json:"table"`
+}
+
+type jsonATAErrorLog struct {
+	Count int `json:"count"`
+	Table []struct {
+		ErrorNumber      int    `json:"error_number"`
+		LifetimeHours    int    `json:"lifetime_hours"`
+		ErrorDescription string `json:"error_description"`
+	} `json:"table"`
+}
+
+type jsonTemperatureLimits struct {
+	OpLimitMin int `json:"op_limit_min"`
+	OpLimitMax int `json:"op_limit_max"`
+	LimitMin   int `json:"limit_min"`
+	LimitMax   int `json:"limit_max"`
+}
+
+type jsonATASCTStatus struct {
+	DeviceState jsonValueString `json:"device_state"`
+	Temperature struct {
+		jsonTemperatureLimits
+		Current         int `json:"current"`
+		PowerCycleMin   int `json:"power_cycle_min"`
+		PowerCycleMax   int `json:"power_cycle_max"`
+		LifetimeMin     int `json:"lifetime_min"`
+		LifetimeMax     int `json:"lifetime_max"`
+		UnderLimitCount int `json:"under_limit_count"`
+		OverLimitCount  int `json:"over_limit_count"`
+	} `json:"temperature"`
+}
+
+type jsonATASCTTemperatureHistory struct {
+	SamplingPeriodMinutes  int                   `json:"sampling_period_minutes"`
+	LoggingIntervalMinutes int                   `json:"logging_interval_minutes"`
+	Temperature            jsonTemperatureLimits `json:"temperature"`
+	Table                  []*int                `json:"table"` // missing samples are null
+}
+
+type jsonSATAPhyEventCounter struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	Value    int    `json:"value"`
+	Overflow bool   `json:"overflow"`
+}
+
+// jsonNVMeHealthInformation holds the NVMe SMART/Health information log
+// fields reported as integers.
+type jsonNVMeHealthInformation struct {
+	CriticalWarning         *int `json:"critical_warning"`
+	Temperature             *int `json:"temperature"`
+	AvailableSpare          *int `json:"available_spare"`
+	AvailableSpareThreshold *int `json:"available_spare_threshold"`
+	PercentageUsed          *int `json:"percentage_used"`
+	DataUnitsRead           *int `json:"data_units_read"`
+	DataUnitsWritten        *int `json:"data_units_written"`
+	HostReads               *int `json:"host_reads"`
+	HostWrites              *int `json:"host_writes"`
+	ControllerBusyTime      *int `json:"controller_busy_time"`
+	PowerCycles             *int `json:"power_cycles"`
+	PowerOnHours            *int `json:"power_on_hours"`
+	UnsafeShutdowns         *int `json:"unsafe_shutdowns"`
+	MediaErrors             *int `json:"media_errors"`
+	NumErrLogEntries        *int `json:"num_err_log_entries"`
+	WarningTempTime         *int `json:"warning_temp_time"`
+	CriticalCompTime        *int `json:"critical_comp_time"`
+}
+
+// Map returns the reported fields by JSON name.
+func (h jsonNVMeHealthInformation) Map() map[string]int {
+	fields := [...]struct {
+		name  string
+		value *int
+	}{
+		{"critical_warning", h.CriticalWarning},
+		{"temperature", h.Temperature},
+		{"available_spare", h.AvailableSpare},
+		{"available_spare_threshold", h.AvailableSpareThreshold},
+		{"percentage_used", h.PercentageUsed},
+		{"data_units_read", h.DataUnitsRead},
+		{"data_units_written", h.DataUnitsWritten},
+		{"host_reads", h.HostReads},
+		{"host_writes", h.HostWrites},
+		{"controller_busy_time", h.ControllerBusyTime},
+		{"power_cycles", h.PowerCycles},
+		{"power_on_hours", h.PowerOnHours},
+		{"unsafe_shutdowns", h.UnsafeShutdowns},
+		{"media_errors", h.MediaErrors},
+		{"num_err_log_entries", h.NumErrLogEntries},
+		{"warning_temp_time", h.WarningTempTime},
+		{"critical_comp_time", h.CriticalCompTime},
+	}
+	out := make(map[string]int, len(fields))
+	for _, field := range fields {
+		if field.value != nil {
+			out[field.name] = *field.value
+		}
+	}
+	return out
+}
+
+type jsonNVMeErrorInformationLog struct {
+	Size   int `json:"size"`
+	Read   int `json:"read"`
+	Unread int `json:"unread"`
+	Table  []struct {
+		ErrorCount        int `json:"error_count"`
+		SubmissionQueueID int `json:"submission_queue_id"`
+		CommandID         int `json:"command_id"`
+		StatusField       struct {
+			StatusCodeType int    `json:"status_code_type"`
+			StatusCode     int    `json:"status_code"`
+			String         string `json:"string"`
+			DoNotRetry     bool   `json:"do_not_retry"`
+		} `json:"status_field"`
+		LBA struct {
+			Value int `json:"value"`
+		} `json:"lba"`
+		NSID int `json:"nsid"`
+	} `json:"table"`
+}
+
+type jsonNVMeSelfTestLog struct {
+	CurrentSelfTestOperation         jsonValueString `json:"current_self_test_operation"`
+	CurrentSelfTestCompletionPercent int             `json:"current_self_test_completion_percent"`
+	Table                            []struct {
+		SelfTestCode   jsonValueString `json:"self_test_code"`
+		SelfTestResult jsonValueString `json:"self_test_result"`
+		PowerOnHours   int             `json:"power_on_hours"`
+		LBA            int             `json:"lba"`
+	} `json:"table"`
+}
+
+type jsonSCSIErrorCounterLog struct {
+	Read   *jsonSCSIErrorCounters `json:"read"`
+	Write  *jsonSCSIErrorCounters `json:"write"`
+	Verify *jsonSCSIErrorCounters `json:"verify"`
+}
+
+type jsonSCSIErrorCounters struct {
+	ErrorsCorrectedByECCFast         int    `json:"errors_corrected_by_eccfast"`
+	ErrorsCorrectedByECCDelayed      int    `json:"errors_corrected_by_eccdelayed"`
+	ErrorsCorrectedByRereadsRewrites int    `json:"errors_corrected_by_rereads_rewrites"`
+	TotalErrorsCorrected             int    `json:"total_errors_corrected"`
+	CorrectionAlgorithmInvocations   int    `json:"correction_algorithm_invocations"`
+	GigabytesProcessed               string `json:"gigabytes_processed"` // e.g. "1234.567"
+	TotalUncorrectedErrors           int    `json:"total_uncorrected_errors"`
+}
+
+type jsonSCSIStartStopCycleCounter struct {
+	YearOfManufacture                          string `json:"year_of_manufacture"`
+	WeekOfManufacture                          string `json:"week_of_manufacture"`
+	SpecifiedCycleCountOverDeviceLifetime      int    `json:"specified_cycle_count_over_device_lifetime"`
+	AccumulatedStartStopCycles                 int    `json:"accumulated_start_stop_cycles"`
+	SpecifiedLoadUnloadCountOverDeviceLifetime int    `json:"specified_load_unload_count_over_device_lifetime"`
+	AccumulatedLoadUnloadCycles                int    `json:"accumulated_load_unload_cycles"`
+}
+
+// missingFields collects the JSON fields expected in the smartctl output, but
+// not reported.
+type missingFields []string
+
+// check records path as missing when not present, and returns present.
+func (m *missingFields) check(present bool, path string) bool {
+	if !present {
+		*m = append(*m, path)
+	}
+	return present
+}
+
+func decodeOutput(output []byte, out interface{}) error {
+	if err := json.Unmarshal(output, out); err != nil {
+		return fmt.Errorf("decoding smartctl output: %w", err)
+	}
+	return nil
+}
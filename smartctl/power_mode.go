@@ -0,0 +1,75 @@
+package smartctl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SkipPowerMode is the lowest power mode in which smartctl does not query a
+// device, so that it does not spin up (smartctl -n).
+type SkipPowerMode string
+
+const (
+	SkipNever   SkipPowerMode = "never"
+	SkipSleep   SkipPowerMode = "sleep"
+	SkipStandby SkipPowerMode = "standby"
+	SkipIdle    SkipPowerMode = "idle"
+)
+
+func (m SkipPowerMode) Valid() bool {
+	switch m {
+	case SkipNever, SkipSleep, SkipStandby, SkipIdle:
+		return true
+	}
+	return false
+}
+
+// PowerMode is the power mode of a device, known when the command skips
+// devices in low power modes. Values are ordered by power consumption.
+type PowerMode int
+
+const (
+	PowerModeUnknown PowerMode = iota
+	PowerModeActive            // active or idle, the device was queried
+	PowerModeIdle
+	PowerModeStandby
+	PowerModeSleep
+)
+
+func (m PowerMode) String() string {
+	switch m {
+	case PowerModeActive:
+		return "active"
+	case PowerModeIdle:
+		return "idle"
+	case PowerModeStandby:
+		return "standby"
+	case PowerModeSleep:
+		return "sleep"
+	}
+	return "unknown"
+}
+
+// Example message: "Device is in STANDBY mode, exit(2)"
+var skippedDeviceRegexp = regexp.MustCompile(`^Device is in (\S+) mode`)
+
+// skippedPowerMode returns the power mode smartctl reports when it skips a
+// device, PowerModeUnknown if the device was not skipped.
+func skippedPowerMode(messages []jsonMessage) PowerMode {
+	for _, msg := range messageStrings(messages) {
+		match := skippedDeviceRegexp.FindStringSubmatch(msg)
+		if match == nil {
+			continue
+		}
+		// Modes have variants, e.g. STANDBY_Y or IDLE_A
+		switch name := strings.ToUpper(match[1]); {
+		case strings.HasPrefix(name, "SLEEP"):
+			return PowerModeSleep
+		case strings.HasPrefix(name, "STANDBY"):
+			return PowerModeStandby
+		case strings.HasPrefix(name, "IDLE"):
+			return PowerModeIdle
+		}
+	}
+	return PowerModeUnknown
+}
@@ -0,0 +1,155 @@
+package smartctl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Invocation describes how the smartctl query of a device went.
+type Invocation struct {
+	QueueWait time.Duration // time spent waiting for the query turn, see Limiter
+	WallTime  time.Duration
+	CPUTime   time.Duration // user and system time, sudo and smartctl included
+}
+
+// execution is the result of a smartctl process.
+type execution struct {
+	cmdline  string
+	stdout   []byte
+	stderr   []byte
+	wallTime time.Duration
+	cpuTime  time.Duration
+}
+
+const (
+	// killGracePeriod is the time smartctl gets to exit on timeout, once
+	// terminated, before being killed.
+	killGracePeriod = 2 * time.Second
+	// outputDrainTimeout bounds the time waiting for the outputs to be closed
+	// once the process exited: descendants of the process, which could not be
+	// killed, may keep them open.
+	outputDrainTimeout = time.Second
+)
+
+// execute runs smartctl in its own process group. On timeout, the group is
+// terminated first: sudo relays the signal to smartctl, even when running it
+// in another session (use_pty), out of reach of the group. The group is killed
+// after a grace period. Standard output and error are captured separately.
+func (c *Command) execute(ctx context.Context, args ...string) (execution, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := c.command(args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	result := execution{cmdline: cmd.String()}
+
+	stdout, err := newOutput()
+	if err != nil {
+		return result, err
+	}
+	defer stdout.close()
+	stderr, err := newOutput()
+	if err != nil {
+		return result, err
+	}
+	defer stderr.close()
+	cmd.Stdout = stdout.w
+	cmd.Stderr = stderr.w
+
+	start := time.Now()
+	err = cmd.Start()
+	// The process holds its own copy of the write ends
+	stdout.w.Close()
+	stderr.w.Close()
+	if err != nil {
+		return result, err
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			killed <- false
+			return
+		}
+		// A negative PID targets the process group
+		_ = syscall.Kill(-pid, syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(killGracePeriod):
+			_ = syscall.Kill(-pid, syscall.SIGKILL)
+		}
+		killed <- true
+	}()
+	err = cmd.Wait()
+	close(exited)
+
+	drainDeadline := time.Now().Add(outputDrainTimeout)
+	result.stdout = stdout.bytes(drainDeadline)
+	result.stderr = stderr.bytes(drainDeadline)
+	result.wallTime = time.Since(start)
+	if state := cmd.ProcessState; state != nil {
+		result.cpuTime = state.UserTime() + state.SystemTime()
+	}
+	if <-killed && err != nil {
+		return result, fmt.Errorf("killed after %s: %w", result.wallTime.Round(time.Millisecond), ctx.Err())
+	}
+	return result, err
+}
+
+// output captures the output of a process through a pipe. Unlike the pipes
+// set up by exec.Cmd, waiting for the process does not wait for the pipe to
+// be closed.
+type output struct {
+	r, w *os.File
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+func newOutput() (*output, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	o := &output{r: r, w: w, done: make(chan struct{})}
+	go func() {
+		_, _ = io.Copy(&o.buf, r)
+		close(o.done)
+	}()
+	return o, nil
+}
+
+// bytes returns the output read until the pipe is closed, or until the
+// deadline.
+func (o *output) bytes(deadline time.Time) []byte {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-o.done:
+	case <-timer.C:
+		// Unblocks the copy
+		o.r.Close()
+		<-o.done
+	}
+	return o.buf.Bytes()
+}
+
+func (o *output) close() {
+	o.w.Close()
+	o.r.Close()
+	<-o.done
+}
+
+// command builds the smartctl command line, run through the executor.
+func (c *Command) command(args ...string) *exec.Cmd {
+	cmdline := c.executor.CommandLine(c.smartctlBinary, args)
+	return exec.Command(cmdline[0], cmdline[1:]...)
+}
@@ -0,0 +1,239 @@
+package smartctl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RawDecoderFunc decodes the raw value of an ATA SMART attribute. It returns
+// false when the raw value does not have the expected format, the attribute
+// then keeping the raw value reported by smartctl.
+type RawDecoderFunc func(attr ATASmartAttribute) (int, bool)
+
+// Built-in raw value decoders.
+const (
+	// RawDecoderRaw keeps the raw value reported by smartctl.
+	RawDecoderRaw = "raw"
+	// RawDecoderLeadingNumber parses the number at the start of the raw string,
+	// as in temperatures "26 (Min/Max 20/40)".
+	RawDecoderLeadingNumber = "leading_number"
+	// RawDecoderHours parses durations such as "12345h+06m+07s" into hours.
+	RawDecoderHours = "hours"
+	// RawDecoderSeagateErrors and RawDecoderSeagateOperations split Seagate
+	// error rates, packing the error count in the upper 16 bits and the number
+	// of operations in the lower 32 bits. They are meant for parts, see
+	// RawDecoderRule.
+	RawDecoderSeagateErrors     = "seagate_errors"
+	RawDecoderSeagateOperations = "seagate_operations"
+)
+
+var (
+	rawDecoderFuncsLock sync.RWMutex
+	rawDecoderFuncs     = map[string]RawDecoderFunc{
+		RawDecoderRaw:               decodeRaw,
+		RawDecoderLeadingNumber:     decodeLeadingNumber,
+		RawDecoderHours:             decodeHours,
+		RawDecoderSeagateErrors:     decodeSeagateErrors,
+		RawDecoderSeagateOperations: decodeSeagateOperations,
+	}
+)
+
+// RegisterRawDecoder adds a raw value decoder, usable by name in the rules of
+// the RawDecoders built afterwards.
+func RegisterRawDecoder(name string, decode RawDecoderFunc) {
+	rawDecoderFuncsLock.Lock()
+	defer rawDecoderFuncsLock.Unlock()
+	rawDecoderFuncs[name] = decode
+}
+
+func lookupRawDecoder(name string) (RawDecoderFunc, bool) {
+	rawDecoderFuncsLock.RLock()
+	defer rawDecoderFuncsLock.RUnlock()
+	decode, ok := rawDecoderFuncs[name]
+	return decode, ok
+}
+
+// RawDecoderNames returns the names of the registered decoders.
+func RawDecoderNames() []string {
+	rawDecoderFuncsLock.RLock()
+	defer rawDecoderFuncsLock.RUnlock()
+	names := make([]string, 0, len(rawDecoderFuncs))
+	for name := range rawDecoderFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RawDecoderRule selects the decoder of the attributes matching its ID or
+// name (case-insensitive), and optionally the model family of the device.
+// Rules with a Part decode a named part of packed raw values, e.g. "errors",
+// reported in addition to the decoded raw value of the attribute.
+type RawDecoderRule struct {
+	ID          int
+	Name        string
+	ModelFamily string // regular expression, empty matches any device
+	Decoder     string
+	Part        string
+}
+
+// DefaultRawDecoderRules are the rules applied after the configured ones.
+var DefaultRawDecoderRules = []RawDecoderRule{
+	{Name: "temperature_celsius", Decoder: RawDecoderLeadingNumber},
+	{Name: "airflow_temperature_cel", Decoder: RawDecoderLeadingNumber},
+	{ID: 9, Decoder: RawDecoderHours},
+	{ID: 1, ModelFamily: "^Seagate", Decoder: RawDecoderSeagateErrors, Part: "errors"},
+	{ID: 1, ModelFamily: "^Seagate", Decoder: RawDecoderSeagateOperations, Part: "operations"},
+	{ID: 7, ModelFamily: "^Seagate", Decoder: RawDecoderSeagateErrors, Part: "errors"},
+	{ID: 7, ModelFamily: "^Seagate", Decoder: RawDecoderSeagateOperations, Part: "operations"},
+}
+
+var partRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// reservedParts are the names of the normalized values of attributes, see
+// the converter.
+var reservedParts = []string{"value", "worst", "thresh", "threshold_margin"}
+
+type rawDecoderRule struct {
+	id          int
+	name        string
+	modelFamily *regexp.Regexp
+	decode      RawDecoderFunc
+	part        string
+}
+
+func (r rawDecoderRule) match(modelFamily string, attr ATASmartAttribute) bool {
+	if r.id != 0 && r.id != attr.ID {
+		return false
+	}
+	if r.name != "" && r.name != strings.ToLower(attr.Name) {
+		return false
+	}
+	return r.modelFamily == nil || r.modelFamily.MatchString(modelFamily)
+}
+
+// RawDecoders decodes raw values using the first matching rule.
+type RawDecoders struct {
+	rules []rawDecoderRule
+}
+
+// NewRawDecoders builds decoders out of the given rules, followed by the
+// default ones.
+func NewRawDecoders(rules ...RawDecoderRule) (*RawDecoders, error) {
+	d := &RawDecoders{}
+	for idx, rule := range append(append([]RawDecoderRule{}, rules...), DefaultRawDecoderRules...) {
+		if rule.ID == 0 && rule.Name == "" {
+			return nil, fmt.Errorf("raw decoder rule %d: attribute ID or name is required", idx)
+		}
+		decode, ok := lookupRawDecoder(rule.Decoder)
+		if !ok {
+			return nil, fmt.Errorf("raw decoder rule %d: unknown decoder %q, expected one of %s", idx, rule.Decoder, strings.Join(RawDecoderNames(), ", "))
+		}
+		compiled := rawDecoderRule{
+			id:     rule.ID,
+			name:   strings.ToLower(rule.Name),
+			decode: decode,
+			part:   rule.Part,
+		}
+		if rule.Part != "" && (!partRegexp.MatchString(rule.Part) || isReservedPart(rule.Part)) {
+			return nil, fmt.Errorf("raw decoder rule %d: invalid part %q, expected a lower-case name other than %s", idx, rule.Part, strings.Join(reservedParts, ", "))
+		}
+		if rule.ModelFamily != "" {
+			re, err := regexp.Compile(rule.ModelFamily)
+			if err != nil {
+				return nil, fmt.Errorf("raw decoder rule %d: invalid model family: %w", idx, err)
+			}
+			compiled.modelFamily = re
+		}
+		d.rules = append(d.rules, compiled)
+	}
+	return d, nil
+}
+
+var defaultRawDecoders, _ = NewRawDecoders()
+
+// Decode returns the decoded raw value of the attribute.
+func (d *RawDecoders) Decode(modelFamily string, attr ATASmartAttribute) int {
+	if d == nil {
+		d = defaultRawDecoders
+	}
+	for _, rule := range d.rules {
+		if rule.part != "" || !rule.match(modelFamily, attr) {
+			continue
+		}
+		if value, ok := rule.decode(attr); ok {
+			return value
+		}
+		break
+	}
+	return attr.Raw
+}
+
+// DecodeParts returns the decoded parts of the raw value of the attribute, by
+// name, nil when no rule applies. Each part is decoded by the first matching
+// rule able to decode it.
+func (d *RawDecoders) DecodeParts(modelFamily string, attr ATASmartAttribute) map[string]int {
+	if d == nil {
+		d = defaultRawDecoders
+	}
+	var parts map[string]int
+	for _, rule := range d.rules {
+		if rule.part == "" || !rule.match(modelFamily, attr) {
+			continue
+		}
+		if _, ok := parts[rule.part]; ok {
+			continue
+		}
+		if value, ok := rule.decode(attr); ok {
+			if parts == nil {
+				parts = make(map[string]int)
+			}
+			parts[rule.part] = value
+		}
+	}
+	return parts
+}
+
+func isReservedPart(part string) bool {
+	for _, reserved := range reservedParts {
+		if part == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeRaw(attr ATASmartAttribute) (int, bool) {
+	return attr.Raw, true
+}
+
+func decodeLeadingNumber(attr ATASmartAttribute) (int, bool) {
+	var value int
+	if _, err := fmt.Sscan(attr.RawString, &value); err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+var hoursRegexp = regexp.MustCompile(`^(\d+)h\+`)
+
+func decodeHours(attr ATASmartAttribute) (int, bool) {
+	match := hoursRegexp.FindStringSubmatch(attr.RawString)
+	if match == nil {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(match[1])
+	return hours, err == nil
+}
+
+func decodeSeagateErrors(attr ATASmartAttribute) (int, bool) {
+	return attr.Raw >> 32 & 0xffff, true
+}
+
+func decodeSeagateOperations(attr ATASmartAttribute) (int, bool) {
+	return attr.Raw & 0xffffffff, true
+}
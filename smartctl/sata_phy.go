@@ -0,0 +1,24 @@
+package smartctl
+
+// SATAPhyEventCounter is an entry of the SATA Phy event counters log (-l sataphy).
+// Counters stop at their maximum value, reporting an overflow: the actual
+// number of events is then greater or equal to Value.
+type SATAPhyEventCounter struct {
+	ID       int
+	Name     string
+	Size     int // in bytes
+	Value    int
+	Overflow bool
+}
+
+func extractSATAPhyEventCounters(out *jsonOutput) []SATAPhyEventCounter {
+	if out.SATAPhyEventCounters == nil {
+		return nil
+	}
+
+	var res []SATAPhyEventCounter
+	for _, counter := range out.SATAPhyEventCounters.Table {
+		res = append(res, SATAPhyEventCounter(counter))
+	}
+	return res
+}
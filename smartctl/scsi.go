@@ -0,0 +1,93 @@
+package smartctl
+
+import (
+	"strconv"
+)
+
+// SCSIErrorCounterLog holds the error counters of each operation type (-l error).
+// Counters of unsupported operations are nil.
+type SCSIErrorCounterLog struct {
+	Read   *SCSIErrorCounters
+	Write  *SCSIErrorCounters
+	Verify *SCSIErrorCounters
+}
+
+type SCSIErrorCounters struct {
+	CorrectedByECCFast             int
+	CorrectedByECCDelayed          int
+	CorrectedByRereadsRewrites     int
+	TotalCorrected                 int
+	CorrectionAlgorithmInvocations int
+	GigabytesProcessed             float64
+	TotalUncorrected               int
+}
+
+// SCSIStartStopCycleCounter is the start-stop cycle counter log page.
+type SCSIStartStopCycleCounter struct {
+	YearOfManufacture           string
+	WeekOfManufacture           string
+	SpecifiedCycleCount         int // over the device lifetime
+	AccumulatedStartStopCycles  int
+	SpecifiedLoadUnloadCount    int // over the device lifetime
+	AccumulatedLoadUnloadCycles int
+}
+
+// Temperature is the current drive temperature, with the temperature at which
+// the drive trips, when known (0 otherwise).
+type Temperature struct {
+	Current   int
+	DriveTrip int
+}
+
+func extractSCSIErrorCounterLog(out *jsonOutput) *SCSIErrorCounterLog {
+	log := out.SCSIErrorCounterLog
+	if log == nil {
+		return nil
+	}
+	return &SCSIErrorCounterLog{
+		Read:   extractSCSIErrorCounters(log.Read),
+		Write:  extractSCSIErrorCounters(log.Write),
+		Verify: extractSCSIErrorCounters(log.Verify),
+	}
+}
+
+func extractSCSIErrorCounters(counters *jsonSCSIErrorCounters) *SCSIErrorCounters {
+	if counters == nil {
+		return nil
+	}
+	gigabytes, _ := strconv.ParseFloat(counters.GigabytesProcessed, 64)
+	return &SCSIErrorCounters{
+		CorrectedByECCFast:             counters.ErrorsCorrectedByECCFast,
+		CorrectedByECCDelayed:          counters.ErrorsCorrectedByECCDelayed,
+		CorrectedByRereadsRewrites:     counters.ErrorsCorrectedByRereadsRewrites,
+		TotalCorrected:                 counters.TotalErrorsCorrected,
+		CorrectionAlgorithmInvocations: counters.CorrectionAlgorithmInvocations,
+		GigabytesProcessed:             gigabytes,
+		TotalUncorrected:               counters.TotalUncorrectedErrors,
+	}
+}
+
+func extractSCSIStartStopCycleCounter(out *jsonOutput) *SCSIStartStopCycleCounter {
+	counter := out.SCSIStartStopCycleCounter
+	if counter == nil {
+		return nil
+	}
+	return &SCSIStartStopCycleCounter{
+		YearOfManufacture:           counter.YearOfManufacture,
+		WeekOfManufacture:           counter.WeekOfManufacture,
+		SpecifiedCycleCount:         counter.SpecifiedCycleCountOverDeviceLifetime,
+		AccumulatedStartStopCycles:  counter.AccumulatedStartStopCycles,
+		SpecifiedLoadUnloadCount:    counter.SpecifiedLoadUnloadCountOverDeviceLifetime,
+		AccumulatedLoadUnloadCycles: counter.AccumulatedLoadUnloadCycles,
+	}
+}
+
+func extractTemperature(out *jsonOutput) *Temperature {
+	if out.Temperature == nil || out.Temperature.Current == nil {
+		return nil
+	}
+	return &Temperature{
+		Current:   *out.Temperature.Current,
+		DriveTrip: out.Temperature.DriveTrip,
+	}
+}
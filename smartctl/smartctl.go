@@ -1,14 +1,14 @@
 package smartctl
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
-
-	"github.com/stretchr/objx"
 )
 
 const DefaultCommandTimeout = 15 * time.Second
@@ -16,15 +16,20 @@ const DefaultCommandTimeout = 15 * time.Second
 type Command struct {
 	smartctlBinary string
 	smartctlArgs   []string
-	useSudo        bool
+	executor       Executor
 	timeout        time.Duration
+	skipPowerMode  SkipPowerMode
+	rawDecoders    *RawDecoders
+	driveDB        string
+	limiter        *Limiter
 }
 
 type CommandOption func(*Command)
 
-func WithSudoEnabled() CommandOption {
+// WithExecutor runs smartctl through the executor, e.g. SudoExecutor.
+func WithExecutor(e Executor) CommandOption {
 	return func(c *Command) {
-		c.useSudo = true
+		c.executor = e
 	}
 }
 
@@ -34,6 +39,67 @@ func WithTimeout(t time.Duration) CommandOption {
 	}
 }
 
+// WithLogs requests additional device logs, as in smartctl -l <name>.
+func WithLogs(names ...string) CommandOption {
+	return func(c *Command) {
+		for _, name := range names {
+			c.smartctlArgs = append(c.smartctlArgs, "-l", name)
+		}
+	}
+}
+
+// WithExtraArgs adds arguments to the device queries, e.g. attribute
+// relabels such as -v 1,raw48,Raw_Read_Error_Rate.
+func WithExtraArgs(args ...string) CommandOption {
+	return func(c *Command) {
+		c.smartctlArgs = append(c.smartctlArgs, args...)
+	}
+}
+
+// WithSkipIfInPowerMode does not query devices in the given power mode, or
+// a lower one, so that they do not spin up. Skipped devices are reported
+// with Data.Skipped set.
+func WithSkipIfInPowerMode(mode SkipPowerMode) CommandOption {
+	return func(c *Command) {
+		c.skipPowerMode = mode
+	}
+}
+
+// WithDriveDB reads the drive database file in addition to the default one
+// (smartctl -B +FILE), e.g. for drive models unknown to the installed smartctl.
+func WithDriveDB(path string) CommandOption {
+	return func(c *Command) {
+		c.driveDB = path
+		c.smartctlArgs = append(c.smartctlArgs, "-B", "+"+path)
+	}
+}
+
+// WithAttributePresets relabels ATA SMART attributes or changes their raw
+// value format, as in smartctl -v ID,FORMAT[,NAME[,HDD|SSD]].
+func WithAttributePresets(presets ...string) CommandOption {
+	return func(c *Command) {
+		for _, preset := range presets {
+			c.smartctlArgs = append(c.smartctlArgs, "-v", preset)
+		}
+	}
+}
+
+// WithLimiter makes device queries wait for their turn, the limiter being
+// shared with the commands of the other devices.
+func WithLimiter(l *Limiter) CommandOption {
+	return func(c *Command) {
+		c.limiter = l
+	}
+}
+
+// WithRawDecoders decodes the raw values of ATA SMART attributes using the
+// given decoders, instead of the default ones.
+func WithRawDecoders(decoders *RawDecoders) CommandOption {
+	return func(c *Command) {
+		c.rawDecoders = decoders
+	}
+}
+
 func WithSmartctlBinary(binaryPath string) CommandOption {
 	return func(c *Command) {
 		c.smartctlBinary = binaryPath
@@ -43,8 +109,8 @@ func WithSmartctlBinary(binaryPath string) CommandOption {
 func NewCommand(opts ...CommandOption) *Command {
 	cmd := &Command{
 		smartctlBinary: "smartctl",
-		smartctlArgs:   []string{"-i", "-A", "-l", "devstat", "--json=c"},
-		useSudo:        false,
+		smartctlArgs:   []string{"-i", "-H", "-c", "-A", "-l", "devstat", "-l", "selftest", "-l", "error", "-l", "xerror", "--json=c"},
+		executor:       DirectExecutor{},
 		timeout:        DefaultCommandTimeout,
 	}
 
@@ -55,61 +121,163 @@ func NewCommand(opts ...CommandOption) *Command {
 	return cmd
 }
 
-func (c *Command) QueryDevice(ctx context.Context, device string) (Data, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
-	defer cancel()
+func (c *Command) QueryDevice(ctx context.Context, device Device) (Data, error) {
+	args := make([]string, 0, len(c.smartctlArgs)+5)
+	args = append(args, c.smartctlArgs...)
+	if c.skipPowerMode != "" {
+		args = append(args, "-n", string(c.skipPowerMode))
+	}
 
-	binary := c.smartctlBinary
-	baseArgs := c.smartctlArgs
-	if c.useSudo {
-		binary = "sudo"
-		baseArgs = append([]string{c.smartctlBinary}, c.smartctlArgs...)
+	release, queueWait, err := c.limiter.Acquire(ctx, device)
+	if err != nil {
+		return Data{}, withDevice(device, fmt.Errorf("waiting to query %s: %w", device.ID(), err))
+	}
+	var out jsonOutput
+	result, err := c.run(ctx, &out, append(args, deviceArgs(device)...)...)
+	release()
+	if err != nil {
+		return Data{}, withDevice(device, err)
 	}
-	cmd := exec.CommandContext(ctx, binary, append(baseArgs, device)...)
 
-	rawBytes, err := cmd.CombinedOutput()
-	output := string(rawBytes)
+	data, err := newData(&out, c.rawDecoders)
+	if err == nil && !data.Skipped && c.skipPowerMode != "" && c.skipPowerMode != SkipNever {
+		data.PowerMode = PowerModeActive
+	}
+	data.Invocation = Invocation{
+		QueueWait: queueWait,
+		WallTime:  result.wallTime,
+		CPUTime:   result.cpuTime,
+	}
+	return data, withDevice(device, err)
+}
+
+// StartSelfTest starts a self-test on the device. smartctl returns immediately,
+// the test running in the background on the device.
+func (c *Command) StartSelfTest(ctx context.Context, device Device, testType SelfTestType) error {
+	if !testType.Valid() {
+		return fmt.Errorf("unsupported self-test type %q", testType)
+	}
+	// Self-tests share the query limits of the device, e.g. its RAID controller
+	release, _, err := c.limiter.Acquire(ctx, device)
 	if err != nil {
-		return Data{}, fmt.Errorf("command %s failed: %w", cmd.String(), richError(output, err))
+		return withDevice(device, fmt.Errorf("waiting to start self-test on %s: %w", device.ID(), err))
+	}
+	var out jsonHeader
+	_, err = c.run(ctx, &out, append([]string{"-t", string(testType), "--json=c"}, deviceArgs(device)...)...)
+	release()
+	if err != nil {
+		return withDevice(device, err)
+	}
+	// Unlike queries, a failing command means the test did not start (e.g. a
+	// test is already running)
+	status := ExitStatus(out.Smartctl.ExitStatus)
+	if status.Has(ExitSMARTCommandFailed) {
+		return withDevice(device, exitStatusError(out.Smartctl.Messages, fmt.Sprintf("starting %s self-test", testType), status))
+	}
+	return nil
+}
+
+// CheckDriveDB returns an error when the drive database file set with
+// WithDriveDB does not exist, or when smartctl fails to load it.
+func (c *Command) CheckDriveDB(ctx context.Context) error {
+	if c.driveDB == "" {
+		return nil
+	}
+	if _, err := os.Stat(c.driveDB); err != nil {
+		return fmt.Errorf("drive database: %w", err)
+	}
+
+	if result, err := c.execute(ctx, "-B", "+"+c.driveDB, "-P", "showall"); err != nil {
+		return fmt.Errorf("command %s failed: %w", result.cmdline, richError(result, err))
+	}
+	return nil
+}
+
+// deviceArgs returns the smartctl arguments selecting the device, the path
+// being last.
+func deviceArgs(device Device) []string {
+	if device.Type == "" {
+		return []string{device.Path}
 	}
+	return []string{"-d", device.Type, device.Path}
+}
+
+// run executes smartctl with the given arguments and decodes its JSON output
+// into out.
+func (c *Command) run(ctx context.Context, out smartctlOutput, args ...string) (execution, error) {
+	result, err := c.execute(ctx, args...)
 
-	raw, err := objx.FromJSON(output)
+	// smartctl reports disk conditions using the exit status bitmask, while still
+	// producing valid output. Only fatal bits are considered a command failure.
+	// Devices skipped because of their power mode are reported with a fatal
+	// exit status too.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		jsonErr := decodeOutput(result.stdout, out)
+		if jsonErr == nil && (!ExitStatus(exitErr.ExitCode()).Fatal() || skippedPowerMode(out.header().Messages) != PowerModeUnknown) {
+			return result, nil
+		}
+	}
 	if err != nil {
-		return Data{}, err
+		var status ExitStatus
+		if exitErr != nil && exitErr.ExitCode() > 0 {
+			status = ExitStatus(exitErr.ExitCode())
+		}
+		// Errors are classified out of the smartctl messages, or the raw output
+		// when not JSON
+		var header jsonHeader
+		output := result.stderr
+		if decodeOutput(result.stdout, &header) != nil {
+			output = append(append([]byte{}, result.stderr...), result.stdout...)
+		}
+		err = fmt.Errorf("command %s failed: %w", result.cmdline, richError(result, err))
+		return result, newQueryError(err, status, header.Smartctl.Messages, output)
 	}
-	return NewData(raw)
+
+	return result, decodeOutput(result.stdout, out)
 }
 
-func richError(output string, err error) error {
+// richError explains the failure of a smartctl process using the messages of
+// its JSON output, falling back to its standard error or its raw output.
+func richError(result execution, err error) error {
+	if len(result.stdout) > 0 && result.stdout[0] == '{' {
+		var header jsonHeader
+		if decodeOutput(result.stdout, &header) == nil {
+			if messages := messageStrings(header.Smartctl.Messages); len(messages) > 0 {
+				return errors.New(strings.Join(messages, "; "))
+			}
+		}
+	}
+
+	// Standard error explains failures happening before smartctl runs, as in
+	// sudo asking for a password
+	output := bytes.TrimSpace(result.stderr)
+	if len(output) == 0 {
+		output = bytes.TrimSpace(result.stdout)
+	}
 	// No output, return process error
 	if len(output) == 0 {
 		return err
 	}
-	// fallback to dumping raw output
-	fallbackErr := fmt.Errorf("%s (error: %w)", output, err)
-
-	// Not a JSON output generated by Smartctl
-	if output[0] != '{' {
-		return fallbackErr
-	}
+	return fmt.Errorf("%s (error: %w)", output, err)
+}
 
-	// Try to decode JSON
-	raw, err := objx.FromJSON(output)
-	if err != nil || !raw.Has("messages") {
-		return fallbackErr
+// exitStatusError builds an error out of the exit status and the messages
+// reported by smartctl.
+func exitStatusError(messages []jsonMessage, action string, status ExitStatus) error {
+	err := fmt.Errorf("%s failed with exit status %d", action, status)
+	if strs := messageStrings(messages); len(strs) > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.Join(strs, "; "))
 	}
+	return newQueryError(err, status, messages, nil)
+}
 
-	messages := []string{}
-	raw.Get("messages").EachObjxMap(func(_ int, m objx.Map) bool {
-		msg := m.Get("string").String()
-		if msg != "" {
-			messages = append(messages, msg)
+func messageStrings(messages []jsonMessage) []string {
+	out := []string{}
+	for _, msg := range messages {
+		if msg.String != "" {
+			out = append(out, msg.String)
 		}
-		return true
-	})
-
-	if len(messages) == 0 {
-		return fallbackErr
 	}
-	return errors.New(strings.Join(messages, "; "))
+	return out
 }
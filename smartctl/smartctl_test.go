@@ -2,9 +2,12 @@ package smartctl
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/stretchr/objx"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,24 +15,64 @@ func runCat(testfile string) (Data, error) {
 	cmd := NewCommand(WithSmartctlBinary("cat"))
 	cmd.smartctlArgs = nil
 
-	return cmd.QueryDevice(context.Background(), testfile)
+	data, err := cmd.QueryDevice(context.Background(), Device{Path: testfile})
+	// Timings change with every run, see TestCommand_Invocation
+	data.Invocation = Invocation{}
+	return data, err
+}
+
+// runCatWithExitStatus outputs the test file content, then exits with the
+// given status, the same way smartctl reports disk conditions.
+func runCatWithExitStatus(testfile string, status int) (Data, error) {
+	cmd := NewCommand(WithSmartctlBinary("sh"))
+	cmd.smartctlArgs = []string{"-c", fmt.Sprintf(`cat "$0"; exit %d`, status)}
+
+	data, err := cmd.QueryDevice(context.Background(), Device{Path: testfile})
+	data.Invocation = Invocation{}
+	return data, err
+}
+
+// decodeJSON decodes a smartctl JSON output snippet.
+func decodeJSON(t *testing.T, output string) *jsonOutput {
+	t.Helper()
+	var out jsonOutput
+	require.NoError(t, decodeOutput([]byte(output), &out))
+	return &out
+}
+
+func repeat(value int, count int) []int {
+	out := make([]int, count)
+	for idx := range out {
+		out[idx] = value
+	}
+	return out
 }
 
 func TestCommand_QueryDevice(t *testing.T) {
 	t.Run("should work with SATA HDD", func(t *testing.T) {
 		data, err := runCat("testdata/smartctl-output-wd-red.json")
 		require.NoError(t, err)
+		rpm7200 := 7200
 
 		expected := Data{
 			Device: DeviceInfo{
-				Name:            "/dev/sdc",
-				Type:            "sat",
-				Protocol:        "ATA",
-				ModelFamily:     "Western Digital Red Pro",
-				ModelName:       "WDC WD4003FFBX-68MU3N0",
-				SerialNumber:    "VBGHW31F",
-				FirmwareVersion: "83.00A83",
+				Name:             "/dev/sdc",
+				Type:             "sat",
+				Protocol:         "ATA",
+				ModelFamily:      "Western Digital Red Pro",
+				ModelName:        "WDC WD4003FFBX-68MU3N0",
+				SerialNumber:     "VBGHW31F",
+				FirmwareVersion:  "83.00A83",
+				FormFactor:       "3.5 inches",
+				WWN:              "5000cca095c7374a",
+				SATAVersion:      "SATA 3.2",
+				UserCapacity:     4000787030016,
+				LogicalBlockSize: 512,
+				RotationRate:     &rpm7200,
 			},
+			SmartctlVersion: Version{Major: 7, Minor: 2},
+			Health:          HealthPassed,
+			PowerOnHours:    7598,
 			ATADeviceStats: map[string]int{
 				"average long term temperature":                35,
 				"average short term temperature":               36,
@@ -63,24 +106,69 @@ func TestCommand_QueryDevice(t *testing.T) {
 				"time in over-temperature":                     0,
 				"time in under-temperature":                    0,
 			},
-			ATASmartAttributes: map[string]int{
-				"current_pending_sector":  0,
-				"load_cycle_count":        333,
-				"offline_uncorrectable":   0,
-				"power-off_retract_count": 333,
-				"power_cycle_count":       17,
-				"power_on_hours":          7598,
-				"raw_read_error_rate":     0,
-				"reallocated_event_count": 0,
-				"reallocated_sector_ct":   0,
-				"seek_error_rate":         0,
-				"seek_time_performance":   18,
-				"spin_retry_count":        0,
-				"spin_up_time":            34374156674,
-				"start_stop_count":        17,
-				"temperature_celsius":     37,
-				"throughput_performance":  96,
-				"udma_crc_error_count":    0,
+			ATASmartAttributesTable: []ATASmartAttribute{
+				{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Thresh: 16, Flags: 11, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 2, Name: "Throughput_Performance", Value: 132, Worst: 132, Thresh: 54, Flags: 4, Raw: 96, RawString: "96", Decoded: 96},
+				{ID: 3, Name: "Spin_Up_Time", Value: 199, Worst: 199, Thresh: 24, Flags: 7, Raw: 34374156674, RawString: "386 (Average 220)", Decoded: 34374156674},
+				{ID: 4, Name: "Start_Stop_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 18, Raw: 17, RawString: "17", Decoded: 17},
+				{ID: 5, Name: "Reallocated_Sector_Ct", Value: 100, Worst: 100, Thresh: 5, Flags: 51, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 7, Name: "Seek_Error_Rate", Value: 100, Worst: 100, Thresh: 67, Flags: 10, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 8, Name: "Seek_Time_Performance", Value: 128, Worst: 128, Thresh: 20, Flags: 4, Raw: 18, RawString: "18", Decoded: 18},
+				{ID: 9, Name: "Power_On_Hours", Value: 99, Worst: 99, Thresh: 0, Flags: 18, Raw: 7598, RawString: "7598", Decoded: 7598},
+				{ID: 10, Name: "Spin_Retry_Count", Value: 100, Worst: 100, Thresh: 60, Flags: 18, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 12, Name: "Power_Cycle_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 50, Raw: 17, RawString: "17", Decoded: 17},
+				{ID: 192, Name: "Power-Off_Retract_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 50, Raw: 333, RawString: "333", Decoded: 333},
+				{ID: 193, Name: "Load_Cycle_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 18, Raw: 333, RawString: "333", Decoded: 333},
+				{ID: 194, Name: "Temperature_Celsius", Value: 162, Worst: 162, Thresh: 0, Flags: 2, Raw: 193274576933, RawString: "37 (Min/Max 16/45)", Decoded: 37},
+				{ID: 196, Name: "Reallocated_Event_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 50, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 197, Name: "Current_Pending_Sector", Value: 100, Worst: 100, Thresh: 0, Flags: 34, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 198, Name: "Offline_Uncorrectable", Value: 100, Worst: 100, Thresh: 0, Flags: 8, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 199, Name: "UDMA_CRC_Error_Count", Value: 200, Worst: 200, Thresh: 0, Flags: 10, Raw: 0, RawString: "0", Decoded: 0},
+			},
+			ATASelfTestLog: &ATASelfTestLog{},
+			ATASelfTestStatus: &SelfTestStatus{
+				Value:  0,
+				String: "completed without error",
+			},
+			ATAErrorLog: &ATAErrorLog{},
+			ATASCTStatus: &ATASCTStatus{
+				DeviceState:   "Active",
+				Current:       37,
+				PowerCycleMin: 17,
+				PowerCycleMax: 39,
+				LifetimeMin:   16,
+				LifetimeMax:   45,
+				TemperatureLimit: TemperatureLimits{
+					OpLimitMin: 0,
+					OpLimitMax: 60,
+					LimitMin:   -40,
+					LimitMax:   70,
+				},
+			},
+			ATASCTTemperatureHistory: &ATASCTTemperatureHistory{
+				SamplingPeriodMinutes:  1,
+				LoggingIntervalMinutes: 1,
+				TemperatureLimit: TemperatureLimits{
+					OpLimitMin: 0,
+					OpLimitMax: 60,
+					LimitMin:   -40,
+					LimitMax:   70,
+				},
+				Samples: repeat(37, 128),
+			},
+			SATAPhyEventCounters: []SATAPhyEventCounter{
+				{ID: 1, Name: "Command failed due to ICRC error", Size: 2, Value: 0},
+				{ID: 2, Name: "R_ERR response for data FIS", Size: 2, Value: 0},
+				{ID: 3, Name: "R_ERR response for device-to-host data FIS", Size: 2, Value: 0},
+				{ID: 4, Name: "R_ERR response for host-to-device data FIS", Size: 2, Value: 0},
+				{ID: 5, Name: "R_ERR response for non-data FIS", Size: 2, Value: 0},
+				{ID: 6, Name: "R_ERR response for device-to-host non-data FIS", Size: 2, Value: 0},
+				{ID: 7, Name: "R_ERR response for host-to-device non-data FIS", Size: 2, Value: 0},
+				{ID: 8, Name: "Device-to-host non-data FIS retries", Size: 2, Value: 0},
+				{ID: 9, Name: "Transition from drive PhyRdy to drive PhyNRdy", Size: 2, Value: 4},
+				{ID: 10, Name: "Device-to-host register FISes sent due to a COMRESET", Size: 2, Value: 3},
+				{ID: 11, Name: "CRC errors within host-to-device FIS", Size: 2, Value: 0},
+				{ID: 13, Name: "Non-CRC errors within host-to-device FIS", Size: 2, Value: 0},
 			},
 		}
 		require.Equal(t, expected, data)
@@ -89,17 +177,27 @@ func TestCommand_QueryDevice(t *testing.T) {
 	t.Run("should work with SATA SSD", func(t *testing.T) {
 		data, err := runCat("testdata/smartctl-output-ct240bx.json")
 		require.NoError(t, err)
+		ssd := 0
 
 		expected := Data{
 			Device: DeviceInfo{
-				Name:            "/dev/sdb",
-				Type:            "sat",
-				Protocol:        "ATA",
-				ModelFamily:     "Silicon Motion based SSDs",
-				ModelName:       "CT240BX200SSD1",
-				SerialNumber:    "1603F015E628",
-				FirmwareVersion: "MU02.6",
+				Name:             "/dev/sdb",
+				Type:             "sat",
+				Protocol:         "ATA",
+				ModelFamily:      "Silicon Motion based SSDs",
+				ModelName:        "CT240BX200SSD1",
+				SerialNumber:     "1603F015E628",
+				FirmwareVersion:  "MU02.6",
+				WWN:              "500a0751f015e628",
+				SATAVersion:      "SATA 3.1",
+				UserCapacity:     240057409536,
+				LogicalBlockSize: 512,
+				RotationRate:     &ssd,
 			},
+			ExitStatus:      ExitSMARTCommandFailed,
+			SmartctlVersion: Version{Major: 7, Minor: 2},
+			Health:          HealthPassed,
+			PowerOnHours:    3949,
 			ATADeviceStats: map[string]int{
 				"lifetime power-on resets":                     262,
 				"logical sectors read":                         1606061987,
@@ -113,34 +211,96 @@ func TestCommand_QueryDevice(t *testing.T) {
 				"power-on hours":                               3949,
 				"resets between cmd acceptance and completion": 20,
 			},
-			ATASmartAttributes: map[string]int{
-				"available_reservd_space": 100,
-				"average_erase_count":     32,
-				"average_slc_erase_ct":    2663,
-				"erase_fail_count_total":  0,
-				"host_reads_32mib":        90042,
-				"host_writes_32mib":       329495,
-				"initial_bad_block_count": 334,
-				"max_erase_count":         74,
-				"max_slc_erase_ct":        2672,
-				"min_erase_count":         8,
-				"min_slc_erase_ct":        2630,
-				"power-off_retract_count": 20,
-				"power_cycle_count":       262,
-				"power_on_hours":          3949,
-				"program_fail_cnt_total":  0,
-				"raid_recoverty_ct":       0,
-				"raw_read_error_rate":     0,
-				"reallocated_sector_ct":   0,
-				"remaining_lifetime_perc": 97,
-				"slc_writes_32mib":        394222,
-				"tlc_writes_32mib":        247105,
-				"temperature_celsius":     26,
-				"total_erase_count":       41838,
-				"total_slc_erase_ct":      197111,
-				"udma_crc_error_count":    0,
-				"uncorrectable_error_cnt": 0,
-				"valid_spare_block_cnt":   23,
+			ATASmartAttributesTable: []ATASmartAttribute{
+				{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 5, Name: "Reallocated_Sector_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 9, Name: "Power_On_Hours", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 3949, RawString: "3949", Decoded: 3949},
+				{ID: 12, Name: "Power_Cycle_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 262, RawString: "262", Decoded: 262},
+				{ID: 160, Name: "Uncorrectable_Error_Cnt", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 161, Name: "Valid_Spare_Block_Cnt", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 23, RawString: "23", Decoded: 23},
+				{ID: 163, Name: "Initial_Bad_Block_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 334, RawString: "334", Decoded: 334},
+				{ID: 148, Name: "Total_SLC_Erase_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 197111, RawString: "197111", Decoded: 197111},
+				{ID: 149, Name: "Max_SLC_Erase_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 2672, RawString: "2672", Decoded: 2672},
+				{ID: 150, Name: "Min_SLC_Erase_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 2630, RawString: "2630", Decoded: 2630},
+				{ID: 151, Name: "Average_SLC_Erase_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 2663, RawString: "2663", Decoded: 2663},
+				{ID: 164, Name: "Total_Erase_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 41838, RawString: "41838", Decoded: 41838},
+				{ID: 165, Name: "Max_Erase_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 74, RawString: "74", Decoded: 74},
+				{ID: 166, Name: "Min_Erase_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 8, RawString: "8", Decoded: 8},
+				{ID: 167, Name: "Average_Erase_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 32, RawString: "32", Decoded: 32},
+				{ID: 169, Name: "Remaining_Lifetime_Perc", Value: 100, Worst: 100, Thresh: 1, Flags: 0, Raw: 97, RawString: "97", Decoded: 97},
+				{ID: 181, Name: "Program_Fail_Cnt_Total", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 182, Name: "Erase_Fail_Count_Total", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 192, Name: "Power-Off_Retract_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 20, RawString: "20", Decoded: 20},
+				{ID: 194, Name: "Temperature_Celsius", Value: 100, Worst: 100, Thresh: 70, Flags: 0, Raw: 38625247166490, RawString: "26 (35 33 36 35 0)", Decoded: 26},
+				{ID: 199, Name: "UDMA_CRC_Error_Count", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+				{ID: 232, Name: "Available_Reservd_Space", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 100, RawString: "100", Decoded: 100},
+				{ID: 241, Name: "Host_Writes_32MiB", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 329495, RawString: "329495", Decoded: 329495},
+				{ID: 242, Name: "Host_Reads_32MiB", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 90042, RawString: "90042", Decoded: 90042},
+				{ID: 245, Name: "TLC_Writes_32MiB", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 247105, RawString: "247105", Decoded: 247105},
+				{ID: 246, Name: "SLC_Writes_32MiB", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 394222, RawString: "394222", Decoded: 394222},
+				{ID: 247, Name: "Raid_Recoverty_Ct", Value: 100, Worst: 100, Thresh: 0, Flags: 0, Raw: 0, RawString: "0", Decoded: 0},
+			},
+			ATASelfTestLog: &ATASelfTestLog{
+				Count: 18,
+				Entries: []ATASelfTestEntry{
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3949},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3948},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3948},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3947},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3947},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3946},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3946},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3945},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3945},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3944},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3944},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3840},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 102},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3942},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3941},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3941},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3940},
+					{Type: "Offline", Status: 0, StatusString: "Completed without error", LifetimeHours: 3940},
+				},
+			},
+			ATASelfTestStatus: &SelfTestStatus{
+				Value:  0,
+				String: "completed without error",
+			},
+			ATAErrorLog: &ATAErrorLog{},
+			ATASCTStatus: &ATASCTStatus{
+				DeviceState: "Active",
+				TemperatureLimit: TemperatureLimits{
+					OpLimitMax: 100,
+					LimitMax:   100,
+				},
+			},
+			ATASCTTemperatureHistory: &ATASCTTemperatureHistory{
+				SamplingPeriodMinutes:  1,
+				LoggingIntervalMinutes: 1,
+				TemperatureLimit: TemperatureLimits{
+					OpLimitMax: 100,
+					LimitMax:   100,
+				},
+				Samples: repeat(0, 128),
+			},
+			SATAPhyEventCounters: []SATAPhyEventCounter{
+				{ID: 1, Name: "Command failed due to ICRC error", Size: 2, Value: 0},
+				{ID: 2, Name: "R_ERR response for data FIS", Size: 2, Value: 0},
+				{ID: 3, Name: "R_ERR response for device-to-host data FIS", Size: 2, Value: 0},
+				{ID: 4, Name: "R_ERR response for host-to-device data FIS", Size: 2, Value: 0},
+				{ID: 5, Name: "R_ERR response for non-data FIS", Size: 2, Value: 0},
+				{ID: 6, Name: "R_ERR response for device-to-host non-data FIS", Size: 2, Value: 0},
+				{ID: 7, Name: "R_ERR response for host-to-device non-data FIS", Size: 2, Value: 0},
+				{ID: 8, Name: "Device-to-host non-data FIS retries", Size: 2, Value: 0},
+				{ID: 9, Name: "Transition from drive PhyRdy to drive PhyNRdy", Size: 2, Value: 0},
+				{ID: 10, Name: "Device-to-host register FISes sent due to a COMRESET", Size: 2, Value: 4},
+				{ID: 11, Name: "CRC errors within host-to-device FIS", Size: 2, Value: 0},
+				{ID: 13, Name: "Non-CRC errors within host-to-device FIS", Size: 2, Value: 0},
+				{ID: 15, Name: "R_ERR response for host-to-device data FIS, CRC", Size: 2, Value: 0},
+				{ID: 16, Name: "R_ERR response for host-to-device data FIS, non-CRC", Size: 2, Value: 0},
+				{ID: 18, Name: "R_ERR response for host-to-device non-data FIS, CRC", Size: 2, Value: 0},
+				{ID: 19, Name: "R_ERR response for host-to-device non-data FIS, non-CRC", Size: 2, Value: 0},
 			},
 		}
 		require.Equal(t, expected, data)
@@ -152,13 +312,20 @@ func TestCommand_QueryDevice(t *testing.T) {
 
 		expected := Data{
 			Device: DeviceInfo{
-				Name:            "/dev/nvme0n1",
-				Type:            "nvme",
-				Protocol:        "NVMe",
-				ModelName:       "WDC WDS500G2B0C-00PXH0",
-				SerialNumber:    "2044DZ473606",
-				FirmwareVersion: "211070WD",
+				Name:              "/dev/nvme0n1",
+				Type:              "nvme",
+				Protocol:          "NVMe",
+				ModelName:         "WDC WDS500G2B0C-00PXH0",
+				SerialNumber:      "2044DZ473606",
+				FirmwareVersion:   "211070WD",
+				NVMePCIVendor:     "0x15b7",
+				UserCapacity:      500107862016,
+				LogicalBlockSize:  512,
+				NVMeTotalCapacity: 500107862016,
 			},
+			SmartctlVersion: Version{Major: 7, Minor: 2},
+			Health:          HealthPassed,
+			PowerOnHours:    7146,
 			NVMeSmartHealthInfo: map[string]int{
 				"critical_warning":          0,
 				"temperature":               35,
@@ -182,6 +349,59 @@ func TestCommand_QueryDevice(t *testing.T) {
 		require.Equal(t, expected, data)
 	})
 
+	t.Run("should work with SCSI data", func(t *testing.T) {
+		data, err := runCat("testdata/smartctl-output-sas.json")
+		require.NoError(t, err)
+		rpm7200 := 7200
+
+		grownDefects := 8
+		expected := Data{
+			Device: DeviceInfo{
+				Name:             "/dev/sdd",
+				Type:             "scsi",
+				Protocol:         "SCSI",
+				ModelName:        "SEAGATE ST4000NM0023",
+				SerialNumber:     "Z1Z4A8BC0000C4305HBD",
+				FormFactor:       "3.5 inches",
+				UserCapacity:     4000787030016,
+				LogicalBlockSize: 512,
+				RotationRate:     &rpm7200,
+			},
+			SmartctlVersion:     Version{Major: 7, Minor: 2},
+			Health:              HealthPassed,
+			PowerOnHours:        43012,
+			SCSIGrownDefectList: &grownDefects,
+			SCSIErrorCounterLog: &SCSIErrorCounterLog{
+				Read: &SCSIErrorCounters{
+					CorrectedByECCFast:    3842157920,
+					CorrectedByECCDelayed: 12,
+					TotalCorrected:        3842157932,
+					GigabytesProcessed:    451387.112,
+				},
+				Write: &SCSIErrorCounters{
+					GigabytesProcessed: 98211.540,
+				},
+				Verify: &SCSIErrorCounters{
+					CorrectedByECCFast:    1033,
+					CorrectedByECCDelayed: 2,
+					TotalCorrected:        1035,
+					GigabytesProcessed:    3.271,
+					TotalUncorrected:      1,
+				},
+			},
+			SCSIStartStopCycleCounter: &SCSIStartStopCycleCounter{
+				YearOfManufacture:           "2014",
+				WeekOfManufacture:           "31",
+				SpecifiedCycleCount:         10000,
+				AccumulatedStartStopCycles:  105,
+				SpecifiedLoadUnloadCount:    300000,
+				AccumulatedLoadUnloadCycles: 1570,
+			},
+			SCSITemperature: &Temperature{Current: 31, DriveTrip: 68},
+		}
+		require.Equal(t, expected, data)
+	})
+
 	t.Run("should surface smartctl errors", func(t *testing.T) {
 		cmd := NewCommand(
 			WithTimeout(100*time.Millisecond),
@@ -190,10 +410,30 @@ func TestCommand_QueryDevice(t *testing.T) {
 		cmd.smartctlArgs = []string{"testdata/smartctl-output-error-perm.json", ";", "exit"}
 
 		// cat ...; exit 2
-		data, err := cmd.QueryDevice(context.Background(), "2")
+		data, err := cmd.QueryDevice(context.Background(), Device{Path: "2"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Smartctl open device: /dev/sdb [SAT] failed: Permission denied")
+
+		require.Equal(t, Data{}, data)
+	})
+
+	t.Run("should keep data when exit status reports disk conditions", func(t *testing.T) {
+		data, err := runCatWithExitStatus("testdata/smartctl-output-ct240bx.json", 4)
+		require.NoError(t, err)
+		require.Equal(t, "/dev/sdb", data.Device.Name)
+		require.True(t, data.ExitStatus.Has(ExitSMARTCommandFailed))
+		require.False(t, data.ExitStatus.Fatal())
+	})
+
+	t.Run("should fail on fatal exit status", func(t *testing.T) {
+		data, err := runCatWithExitStatus("testdata/smartctl-output-error-perm.json", 2)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "Smartctl open device: /dev/sdb [SAT] failed: Permission denied")
+		require.Equal(t, Data{}, data)
 
+		// exit status is also read from the JSON output
+		data, err = runCat("testdata/smartctl-output-error-perm.json")
+		require.EqualError(t, err, "smartctl failed with exit status 2: Smartctl open device: /dev/sdb [SAT] failed: Permission denied")
 		require.Equal(t, Data{}, data)
 	})
 
@@ -206,11 +446,588 @@ func TestCommand_QueryDevice(t *testing.T) {
 
 		// sleep 5
 		startDate := time.Now()
-		data, err := cmd.QueryDevice(context.Background(), "5")
+		data, err := cmd.QueryDevice(context.Background(), Device{Path: "5"})
 		elapsed := time.Since(startDate)
-		require.Error(t, err)
-		require.Contains(t, err.Error(), "signal: killed")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "killed after")
 		require.Less(t, elapsed, 4*time.Second)
 		require.Equal(t, Data{}, data)
 	})
 }
+
+func TestNewData_MissingFields(t *testing.T) {
+	data, err := NewData([]byte(`{"smartctl": {"exit_status": 0}, "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+		"ata_smart_attributes": {"table": [
+			{"id": 5, "name": "Reallocated_Sector_Ct", "value": 100, "worst": 100, "thresh": 10, "raw": {"value": 0, "string": "0"}},
+			{"id": 9, "name": "Power_On_Hours", "value": 99, "worst": 99, "thresh": 0}
+		]},
+		"ata_smart_error_log": {"summary": {"count": 0}}}`))
+	require.NoError(t, err)
+	require.Len(t, data.ATASmartAttributesTable, 2)
+	require.Equal(t, HealthUnknown, data.Health)
+	require.Equal(t, []string{
+		"smart_status.passed",
+		"power_on_time.hours",
+		"ata_smart_attributes.table.power_on_hours.raw",
+		"ata_device_statistics",
+		"ata_smart_self_test_log",
+		"ata_smart_data.self_test.status",
+	}, data.MissingFields)
+
+	_, err = NewData([]byte(`{"smartctl": {"exit_status": 0}`))
+	require.Error(t, err)
+}
+
+func TestNewData_DuplicateATAAttributes(t *testing.T) {
+	data, err := NewData([]byte(`{"smartctl": {"exit_status": 0}, "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+		"ata_smart_attributes": {"table": [
+			{"id": 170, "name": "Unknown_Attribute", "value": 100, "worst": 100, "thresh": 10, "raw": {"value": 3, "string": "3"}},
+			{"id": 171, "name": "Unknown_Attribute", "value": 100, "worst": 100, "thresh": 0, "raw": {"value": 7, "string": "7"}},
+			{"id": 194, "name": "Temperature_Celsius", "value": 64, "worst": 50, "thresh": 0, "raw": {"value": 154620018714, "string": "26 (Min/Max 20/36)"}}
+		]}}`))
+	require.NoError(t, err)
+	require.Equal(t, 3, data.ATASmartAttributesTable[0].Decoded)
+	require.Equal(t, []string{"unknown_attribute"}, data.ATASmartAttributesDuplicates)
+	require.Equal(t, 7, data.ATASmartAttributesTable[1].Decoded)
+	require.Equal(t, 26, data.ATASmartAttributesTable[2].Decoded)
+}
+
+func TestNVMeLogs(t *testing.T) {
+	data, err := runCat("testdata/smartctl-output-nvme-logs.json")
+	require.NoError(t, err)
+
+	require.Equal(t, &NVMeErrorInfoLog{
+		Size: 256,
+		Read: 16,
+		Entries: []NVMeErrorInfoEntry{
+			{ErrorCount: 3, SubmissionQueueID: 2, CommandID: 812, StatusCodeType: 2, StatusCode: 129, Status: "Unrecovered Read Error", DoNotRetry: true, LBA: 488397168, NSID: 1},
+			{ErrorCount: 2, CommandID: 24577, StatusCode: 2, Status: "Invalid Field in Command"},
+			{ErrorCount: 1, CommandID: 4096, StatusCode: 2, Status: "Invalid Field in Command"},
+		},
+	}, data.NVMeErrorInfoLog)
+	last, ok := data.NVMeErrorInfoLog.LastError()
+	require.True(t, ok)
+	require.Equal(t, 3, last.ErrorCount)
+
+	require.Equal(t, &NVMeSelfTestLog{
+		CurrentOperationString: "No self-test in progress",
+		Entries: []NVMeSelfTestEntry{
+			{Code: 1, Type: "Short", ResultString: "Completed without error", PowerOnHours: 7140},
+			{Code: 2, Type: "Extended", Result: 7, ResultString: "Completed: failed segments", PowerOnHours: 7012, LBA: 488397168},
+			{Code: 1, Type: "Short", ResultString: "Completed without error", PowerOnHours: 7000},
+		},
+	}, data.NVMeSelfTestLog)
+	require.False(t, data.NVMeSelfTestLog.InProgress())
+	require.Equal(t, 1, data.NVMeSelfTestLog.FailedCount())
+	require.Len(t, data.NVMeSelfTestLog.LastByType(), 2)
+
+	// Logs are absent from smartctl < 7.3 output
+	data, err = runCat("testdata/smartctl-output-nvme.json")
+	require.NoError(t, err)
+	require.Nil(t, data.NVMeErrorInfoLog)
+	require.Nil(t, data.NVMeSelfTestLog)
+}
+
+func TestATASmartAttribute(t *testing.T) {
+	attr := ATASmartAttribute{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Thresh: 16, Flags: 11}
+	require.Equal(t, 84, attr.ThresholdMargin())
+	require.True(t, attr.Flags.Has(ATAAttributePrefailure|ATAAttributeUpdatedOnline|ATAAttributeErrorRate))
+	require.False(t, attr.Flags.Has(ATAAttributePerformance))
+	require.False(t, attr.Flags.Has(ATAAttributeEventCount))
+}
+
+func TestATASelfTestLog(t *testing.T) {
+	log := ATASelfTestLog{
+		Count:           4,
+		ErrorCountTotal: 1,
+		Entries: []ATASelfTestEntry{
+			{Type: "Short offline", Status: 0, LifetimeHours: 120},
+			{Type: "Extended offline", Status: 0x79, Failed: true, LifetimeHours: 100, LBA: 123456},
+			{Type: "Short offline", Status: 0x79, Failed: true, LifetimeHours: 96, LBA: 123450},
+			{Type: "Extended offline", Status: 0, LifetimeHours: 24},
+		},
+	}
+
+	require.Equal(t, []ATASelfTestEntry{log.Entries[0], log.Entries[1]}, log.LastByType())
+
+	failed, ok := log.LastFailed()
+	require.True(t, ok)
+	require.Equal(t, log.Entries[1], failed)
+	require.Equal(t, 7, failed.StatusCode())
+
+	_, ok = ATASelfTestLog{Entries: log.Entries[:1]}.LastFailed()
+	require.False(t, ok)
+
+	t.Run("should parse standard log with failures", func(t *testing.T) {
+		raw := decodeJSON(t, `{"ata_smart_self_test_log": {"standard": {"revision": 1, "count": 2, "error_count_total": 1, "table": [
+			{"type": {"value": 2, "string": "Extended offline"}, "status": {"value": 121, "string": "Completed: read failure", "remaining_percent": 90, "passed": false}, "lifetime_hours": 100, "lba": 123456},
+			{"type": {"value": 1, "string": "Short offline"}, "status": {"value": 33, "string": "Interrupted (host reset)", "remaining_percent": 10}, "lifetime_hours": 96}
+		]}}}`)
+		require.Equal(t, &ATASelfTestLog{
+			Count:           2,
+			ErrorCountTotal: 1,
+			Entries: []ATASelfTestEntry{
+				{Type: "Extended offline", Status: 121, StatusString: "Completed: read failure", Failed: true, LifetimeHours: 100, LBA: 123456},
+				{Type: "Short offline", Status: 33, StatusString: "Interrupted (host reset)", LifetimeHours: 96},
+			},
+		}, extractATASelfTestLog(raw))
+	})
+}
+
+func TestATAErrorLog(t *testing.T) {
+	raw := decodeJSON(t, `{"ata_smart_error_log": {"summary": {"revision": 1, "count": 12, "logged_count": 5, "table": [
+		{"error_number": 12, "lifetime_hours": 7590, "completion_registers": {"error": 132, "status": 81}, "error_description": "Error: ICRC, ABRT 8 sectors at LBA = 0x00a3f1c8 = 10744264"},
+		{"error_number": 11, "lifetime_hours": 7012, "completion_registers": {"error": 64, "status": 81}, "error_description": "Error: UNC at LBA = 0x0001e240 = 123456"},
+		{"error_number": 10, "lifetime_hours": 7010, "completion_registers": {"error": 4, "status": 81}, "error_description": "Error: ABRT"}
+	]}}}`)
+	log := extractATAErrorLog(raw)
+	require.Equal(t, &ATAErrorLog{
+		Count: 12,
+		Entries: []ATAErrorEntry{
+			{ErrorNumber: 12, LifetimeHours: 7590, Description: "Error: ICRC, ABRT 8 sectors at LBA = 0x00a3f1c8 = 10744264"},
+			{ErrorNumber: 11, LifetimeHours: 7012, Description: "Error: UNC at LBA = 0x0001e240 = 123456"},
+			{ErrorNumber: 10, LifetimeHours: 7010, Description: "Error: ABRT"},
+		},
+	}, log)
+
+	require.Equal(t, []string{"ICRC", "ABRT"}, log.Entries[0].ErrorTypes())
+	require.Equal(t, []string{"UNC"}, log.Entries[1].ErrorTypes())
+	require.Equal(t, []string{"ABRT"}, log.Entries[2].ErrorTypes())
+}
+
+func TestATASCTTemperatureHistory(t *testing.T) {
+	raw := decodeJSON(t, `{"ata_sct_temperature_history": {"version": 2, "sampling_period_minutes": 1, "logging_interval_minutes": 5,
+		"temperature": {"op_limit_min": 0, "op_limit_max": 60, "limit_min": -40, "limit_max": 70},
+		"size": 6, "index": 2, "table": [null, null, 35, 41, 38, 36]}}`)
+	history := extractATASCTTemperatureHistory(raw)
+	require.Equal(t, []int{35, 41, 38, 36}, history.Samples)
+	require.Equal(t, 5, history.LoggingIntervalMinutes)
+
+	min, max, ok := history.MinMax()
+	require.True(t, ok)
+	require.Equal(t, 35, min)
+	require.Equal(t, 41, max)
+
+	_, _, ok = ATASCTTemperatureHistory{}.MinMax()
+	require.False(t, ok)
+}
+
+func TestCommand_Invocation(t *testing.T) {
+	shell := func(script string) *Command {
+		cmd := NewCommand(WithSmartctlBinary("sh"), WithTimeout(200*time.Millisecond))
+		cmd.smartctlArgs = []string{"-c", script}
+		return cmd
+	}
+
+	t.Run("should only decode standard output", func(t *testing.T) {
+		cmd := shell(`echo "sudo: unable to resolve host nas" >&2; cat "$0"`)
+		data, err := cmd.QueryDevice(context.Background(), Device{Path: "testdata/smartctl-output-nvme.json"})
+		require.NoError(t, err)
+		require.Equal(t, "/dev/nvme0n1", data.Device.Name)
+		require.Greater(t, data.Invocation.WallTime, time.Duration(0))
+	})
+
+	t.Run("should report standard error of failed commands", func(t *testing.T) {
+		cmd := shell(`echo "sudo: a password is required" >&2; exit 1`)
+		_, err := cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed: sudo: a password is required (error: exit status 1)")
+	})
+
+	t.Run("should kill the whole process group on timeout", func(t *testing.T) {
+		// The background sleep keeps standard output open, as a hung smartctl
+		// run through sudo would
+		cmd := shell(`sleep 5 & wait`)
+		startDate := time.Now()
+		_, err := cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(startDate), 4*time.Second)
+	})
+
+	t.Run("should terminate the process before killing it", func(t *testing.T) {
+		// As sudo with use_pty, relays the signal to a command running in
+		// another session
+		cmd := shell(`setsid sleep 5 & child=$!; trap 'kill $child; echo relayed >&2; exit 1' TERM; wait`)
+		startDate := time.Now()
+		_, err := cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Contains(t, err.Error(), "relayed")
+		require.Less(t, time.Since(startDate), killGracePeriod)
+	})
+
+	t.Run("should not wait for descendants holding the output", func(t *testing.T) {
+		cmd := shell(`setsid sleep 3 & wait`)
+		startDate := time.Now()
+		_, err := cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(startDate), 2*time.Second)
+	})
+}
+
+func TestQueryError(t *testing.T) {
+	t.Run("should carry the device, exit status and messages", func(t *testing.T) {
+		_, err := runCatWithExitStatus("testdata/smartctl-output-error-perm.json", 2)
+		require.ErrorIs(t, err, ErrPermissionDenied)
+		require.Equal(t, "permission_denied", ErrorClass(err))
+
+		var qe *QueryError
+		require.ErrorAs(t, err, &qe)
+		require.Equal(t, Device{Path: "testdata/smartctl-output-error-perm.json"}, qe.Device)
+		require.Equal(t, ExitDeviceOpenFailed, qe.ExitStatus)
+		require.Equal(t, []Message{
+			{Text: "Smartctl open device: /dev/sdb [SAT] failed: Permission denied", Severity: "error"},
+		}, qe.Messages)
+
+		// exit status read from the JSON output
+		_, err = runCat("testdata/smartctl-output-error-perm.json")
+		require.ErrorIs(t, err, ErrPermissionDenied)
+		require.ErrorAs(t, err, &qe)
+		require.Equal(t, ExitDeviceOpenFailed, qe.ExitStatus)
+	})
+
+	t.Run("should classify errors of the package", func(t *testing.T) {
+		_, err := runCat("testdata/smartctl-output-weird-protocol.json")
+		require.ErrorIs(t, err, ErrUnsupportedProtocol)
+		require.Equal(t, "unsupported_protocol", ErrorClass(err))
+		require.Contains(t, err.Error(), "Weird")
+	})
+
+	for script, class := range map[string]error{
+		`echo "sudo: a password is required" >&2; exit 1`:                      ErrPermissionDenied,
+		`echo "Smartctl open device: /dev/sdz failed: No such device"; exit 2`: ErrNoSuchDevice,
+		`echo "/dev/sdc: Unknown USB bridge [0x152d:0x0578 (0x209)]"; exit 1`:  ErrUnknownUSBBridge,
+		`echo "/dev/sdd: Unable to detect device type"; exit 1`:                ErrUnsupportedProtocol,
+		`echo "Warning: SCT Feature Control command not supported"; exit 4`:    nil,
+		`sleep 5`: ErrTimeout,
+		`echo "Smartctl open device: /dev/sda failed: Input/output error"; exit 2`: nil,
+	} {
+		cmd := NewCommand(WithSmartctlBinary("sh"), WithTimeout(100*time.Millisecond))
+		cmd.smartctlArgs = []string{"-c", script}
+		_, err := cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+		require.Error(t, err, script)
+		if class == nil {
+			require.Equal(t, ErrorClassOther, ErrorClass(err), script)
+			continue
+		}
+		require.ErrorIs(t, err, class, script)
+	}
+
+	require.Equal(t, "", ErrorClass(nil))
+	require.Equal(t, []string{
+		"permission_denied", "no_such_device", "unknown_usb_bridge", "timeout", "unsupported_protocol", "other",
+	}, ErrorClasses())
+}
+
+func TestNewExecutor(t *testing.T) {
+	args := []string{"-i", "/dev/sda"}
+	for executorType, expected := range map[string][]string{
+		"":        {"smartctl", "-i", "/dev/sda"},
+		"sudo":    {"sudo", "-n", "smartctl", "-i", "/dev/sda"},
+		"doas":    {"doas", "-n", "smartctl", "-i", "/dev/sda"},
+		"nsenter": {"nsenter", "-t", "1", "-m", "--", "smartctl", "-i", "/dev/sda"},
+		"prefix":  {"/usr/local/bin/audit", "--", "smartctl", "-i", "/dev/sda"},
+	} {
+		executor, err := NewExecutor(executorType, 0, []string{"/usr/local/bin/audit", "--"})
+		require.NoError(t, err, executorType)
+		require.Equal(t, expected, executor.CommandLine("smartctl", args), executorType)
+	}
+
+	executor, err := NewExecutor(ExecutorNsenter, 42, nil)
+	require.NoError(t, err)
+	require.Equal(t, NsenterExecutor{TargetPID: 42}, executor)
+
+	_, err = NewExecutor(ExecutorPrefix, 0, nil)
+	require.EqualError(t, err, "prefix executor requires a command")
+	_, err = NewExecutor("su", 0, nil)
+	require.EqualError(t, err, `unsupported executor "su", expected direct, sudo, doas, nsenter or prefix`)
+}
+
+func TestCommand_WithExecutor(t *testing.T) {
+	cmd := NewCommand(
+		WithSmartctlBinary("testdata/fake-smartctl.sh"),
+		WithExecutor(PrefixExecutor{"env", "LC_ALL=C"}),
+	)
+	data, err := cmd.QueryDevice(context.Background(), Device{Path: "testdata/smartctl-output-nvme.json"})
+	require.NoError(t, err)
+	require.Equal(t, "/dev/nvme0n1", data.Device.Name)
+
+	cmd = NewCommand(WithExecutor(PrefixExecutor{"false"}))
+	_, err = cmd.QueryDevice(context.Background(), Device{Path: "/dev/sda"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "false smartctl -i")
+}
+
+func TestCommand_WithLogs(t *testing.T) {
+	cmd := NewCommand(WithLogs("scttemp", "sataphy"))
+	require.Equal(t, []string{"-l", "scttemp", "-l", "sataphy"}, cmd.smartctlArgs[len(cmd.smartctlArgs)-4:])
+}
+
+func TestCommand_WithExtraArgs(t *testing.T) {
+	cmd := NewCommand(
+		WithExtraArgs("-v", "1,raw48,Raw_Read_Error_Rate"),
+		WithTimeout(time.Minute),
+	)
+	require.Equal(t, []string{"-v", "1,raw48,Raw_Read_Error_Rate"}, cmd.smartctlArgs[len(cmd.smartctlArgs)-2:])
+	require.Equal(t, time.Minute, cmd.timeout)
+}
+
+func TestCommand_WithSkipIfInPowerMode(t *testing.T) {
+	cmd := NewCommand(
+		WithSmartctlBinary("testdata/fake-smartctl.sh"),
+		WithSkipIfInPowerMode(SkipStandby),
+	)
+
+	t.Run("should report skipped devices", func(t *testing.T) {
+		data, err := cmd.QueryDevice(context.Background(), Device{Path: "testdata/smartctl-output-standby.json"})
+		require.NoError(t, err)
+		data.Invocation = Invocation{}
+		require.Equal(t, Data{
+			Device: DeviceInfo{
+				Name:     "/dev/sdb",
+				Type:     "sat",
+				Protocol: "ATA",
+			},
+			ExitStatus:      ExitDeviceOpenFailed,
+			SmartctlVersion: Version{Major: 7, Minor: 2},
+			Skipped:         true,
+			PowerMode:       PowerModeStandby,
+		}, data)
+	})
+
+	t.Run("should report queried devices as active", func(t *testing.T) {
+		data, err := cmd.QueryDevice(context.Background(), Device{Path: "testdata/smartctl-output-wd-red.json"})
+		require.NoError(t, err)
+		require.False(t, data.Skipped)
+		require.Equal(t, PowerModeActive, data.PowerMode)
+	})
+
+	t.Run("should not report power mode without -n", func(t *testing.T) {
+		data, err := runCat("testdata/smartctl-output-wd-red.json")
+		require.NoError(t, err)
+		require.Equal(t, PowerModeUnknown, data.PowerMode)
+	})
+}
+
+func TestSkippedPowerMode(t *testing.T) {
+	for msg, expected := range map[string]PowerMode{
+		"Device is in SLEEP mode, exit(2)":      PowerModeSleep,
+		"Device is in STANDBY_Y mode, exit(2)":  PowerModeStandby,
+		"Device is in IDLE_A mode, exit(3)":     PowerModeIdle,
+		"Smartctl open device: /dev/sdb failed": PowerModeUnknown,
+	} {
+		raw := decodeJSON(t, fmt.Sprintf(`{"smartctl": {"messages": [{"string": %q}]}}`, msg))
+		require.Equal(t, expected, skippedPowerMode(raw.Smartctl.Messages), msg)
+	}
+}
+
+func TestSATAPhyEventCounters(t *testing.T) {
+	raw := decodeJSON(t, `{"sata_phy_event_counters": {"table": [
+		{"id": 1, "name": "Command failed due to ICRC error", "size": 2, "value": 65535, "overflow": true},
+		{"id": 11, "name": "CRC errors within host-to-device FIS", "size": 4, "value": 12, "overflow": false}
+	], "reset": false}}`)
+	require.Equal(t, []SATAPhyEventCounter{
+		{ID: 1, Name: "Command failed due to ICRC error", Size: 2, Value: 65535, Overflow: true},
+		{ID: 11, Name: "CRC errors within host-to-device FIS", Size: 4, Value: 12},
+	}, extractSATAPhyEventCounters(raw))
+}
+
+func TestSelfTestStatus(t *testing.T) {
+	require.False(t, SelfTestStatus{Value: 0}.InProgress())
+	require.False(t, SelfTestStatus{Value: 0}.Failed())
+	require.True(t, SelfTestStatus{Value: 249, RemainingPercent: 90}.InProgress())
+	require.False(t, SelfTestStatus{Value: 249}.Failed())
+	require.True(t, SelfTestStatus{Value: 0x73}.Failed())
+	require.False(t, SelfTestStatus{Value: 0x10}.Failed())
+}
+
+func TestCommand_StartSelfTest(t *testing.T) {
+	cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"))
+
+	t.Run("should start self-test", func(t *testing.T) {
+		err := cmd.StartSelfTest(context.Background(), Device{Path: "testdata/smartctl-selftest-started.json"}, SelfTestShort)
+		require.NoError(t, err)
+	})
+
+	t.Run("should fail when a self-test is running", func(t *testing.T) {
+		err := cmd.StartSelfTest(context.Background(), Device{Path: "testdata/smartctl-selftest-busy.json"}, SelfTestShort)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "starting short self-test failed with exit status 4: Can't start self-test without aborting current test")
+	})
+
+	t.Run("should reject unknown test types", func(t *testing.T) {
+		require.Error(t, cmd.StartSelfTest(context.Background(), Device{Path: "/dev/sda"}, "select"))
+	})
+}
+
+func TestExitStatus(t *testing.T) {
+	status := ExitDiskFailing | ExitErrorLogHasErrors
+	require.True(t, status.Has(ExitDiskFailing))
+	require.True(t, status.Has(ExitErrorLogHasErrors))
+	require.False(t, status.Has(ExitSelfTestLogHasErrors))
+	require.False(t, status.Fatal())
+	require.True(t, (status | ExitDeviceOpenFailed).Fatal())
+	require.True(t, ExitCommandLineError.Fatal())
+}
+
+// BenchmarkNewData compares typed decoding with the former objx decoding,
+// which parsed the output into a generic map before walking it: parsing alone
+// is a lower bound of its cost.
+func BenchmarkNewData(b *testing.B) {
+	for _, name := range []string{"wd-red", "ct240bx", "nvme", "sas"} {
+		output, err := os.ReadFile("testdata/smartctl-output-" + name + ".json")
+		require.NoError(b, err)
+
+		b.Run(name+"/typed", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewData(output); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/objx", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := objx.FromJSON(string(output)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCommand_ProbeVersion(t *testing.T) {
+	t.Run("should report JSON output version", func(t *testing.T) {
+		cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"))
+		info, err := cmd.ProbeVersion(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, VersionInfo{Version: Version{Major: 7, Minor: 2}, JSONFormat: Version{Major: 1}}, info)
+		require.NoError(t, info.Check())
+		require.True(t, info.Version.Less(RecommendedVersion))
+	})
+
+	t.Run("should detect versions without JSON output", func(t *testing.T) {
+		cmd := NewCommand(WithSmartctlBinary("testdata/fake-smartctl-6.sh"))
+		info, err := cmd.ProbeVersion(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, VersionInfo{Version: Version{Major: 6, Minor: 6}}, info)
+		require.EqualError(t, info.Check(), "smartctl 6.6 is not supported, JSON output requires smartctl 7.0 or later")
+	})
+
+	t.Run("should reject unsupported JSON formats", func(t *testing.T) {
+		info := VersionInfo{Version: Version{Major: 8, Minor: 0}, JSONFormat: Version{Major: 2}}
+		require.Error(t, info.Check())
+	})
+
+	t.Run("should fail on unexpected output", func(t *testing.T) {
+		cmd := NewCommand(WithSmartctlBinary("true"))
+		_, err := cmd.ProbeVersion(context.Background())
+		require.Error(t, err)
+	})
+}
+
+func TestVersion(t *testing.T) {
+	require.Equal(t, "7.2", Version{Major: 7, Minor: 2}.String())
+	require.Equal(t, "unknown", Version{}.String())
+	require.True(t, Version{Major: 6, Minor: 6}.Less(Version{Major: 7}))
+	require.True(t, Version{Major: 7, Minor: 2}.Less(Version{Major: 7, Minor: 3}))
+	require.False(t, Version{Major: 7, Minor: 3}.Less(Version{Major: 7, Minor: 3}))
+}
+
+func TestRawDecoders(t *testing.T) {
+	seagateRate := ATASmartAttribute{ID: 1, Name: "Raw_Read_Error_Rate", Raw: 3<<32 | 123456789, RawString: "3/123456789"}
+	decoders, err := NewRawDecoders()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		family   string
+		attr     ATASmartAttribute
+		expected int
+	}{
+		{"", ATASmartAttribute{ID: 194, Name: "Temperature_Celsius", Raw: 154620018714, RawString: "26 (Min/Max 20/36)"}, 26},
+		{"", ATASmartAttribute{ID: 190, Name: "Airflow_Temperature_Cel", Raw: 606339096, RawString: "24 (Min/Max 20/36)"}, 24},
+		{"", ATASmartAttribute{ID: 9, Name: "Power_On_Hours", Raw: 5312321327065, RawString: "12345h+06m+07.123s"}, 12345},
+		{"", ATASmartAttribute{ID: 9, Name: "Power_On_Hours", Raw: 7598, RawString: "7598"}, 7598},
+		// Seagate error rates are split into parts, keeping the raw value
+		{"Seagate Barracuda 7200.14 (AF)", seagateRate, 3<<32 | 123456789},
+		{"Western Digital Red", seagateRate, 3<<32 | 123456789},
+	} {
+		require.Equal(t, tc.expected, decoders.Decode(tc.family, tc.attr), tc.attr.RawString)
+	}
+
+	t.Run("should decode parts of packed raw values", func(t *testing.T) {
+		require.Equal(t, map[string]int{"errors": 3, "operations": 123456789}, decoders.DecodeParts("Seagate Barracuda 7200.14 (AF)", seagateRate))
+		require.Nil(t, decoders.DecodeParts("Western Digital Red", seagateRate))
+
+		decoders, err := NewRawDecoders(
+			RawDecoderRule{ID: 1, ModelFamily: "^Seagate", Decoder: RawDecoderRaw, Part: "errors"},
+			RawDecoderRule{ID: 1, Decoder: RawDecoderLeadingNumber, Part: "count"},
+		)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"errors": 3<<32 | 123456789, "operations": 123456789, "count": 3}, decoders.DecodeParts("Seagate IronWolf", seagateRate))
+	})
+
+	t.Run("should apply configured rules first", func(t *testing.T) {
+		decoders, err := NewRawDecoders(
+			RawDecoderRule{Name: "raw_read_error_rate", ModelFamily: "^Seagate", Decoder: RawDecoderSeagateOperations},
+			RawDecoderRule{ID: 194, Decoder: RawDecoderRaw},
+		)
+		require.NoError(t, err)
+		require.Equal(t, 123456789, decoders.Decode("Seagate IronWolf", seagateRate))
+		require.Equal(t, 154620018714, decoders.Decode("", ATASmartAttribute{ID: 194, Raw: 154620018714, RawString: "26 (Min/Max 20/36)"}))
+	})
+
+	t.Run("should support custom decoders", func(t *testing.T) {
+		RegisterRawDecoder("test_double", func(attr ATASmartAttribute) (int, bool) {
+			return attr.Raw * 2, true
+		})
+		decoders, err := NewRawDecoders(RawDecoderRule{ID: 5, Decoder: "test_double"})
+		require.NoError(t, err)
+		require.Equal(t, 42, decoders.Decode("", ATASmartAttribute{ID: 5, Raw: 21}))
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		_, err := NewRawDecoders(RawDecoderRule{Decoder: RawDecoderRaw})
+		require.Error(t, err)
+		_, err = NewRawDecoders(RawDecoderRule{ID: 5, Decoder: "unknown"})
+		require.Error(t, err)
+		_, err = NewRawDecoders(RawDecoderRule{ID: 5, ModelFamily: "(", Decoder: RawDecoderRaw})
+		require.Error(t, err)
+		for _, part := range []string{"Errors", "worst", "error count"} {
+			_, err = NewRawDecoders(RawDecoderRule{ID: 5, Decoder: RawDecoderRaw, Part: part})
+			require.Error(t, err, part)
+		}
+	})
+}
+
+func TestCommand_WithDriveDB(t *testing.T) {
+	cmd := NewCommand(
+		WithSmartctlBinary("testdata/fake-smartctl.sh"),
+		WithDriveDB("testdata/drivedb-extra.h"),
+		WithAttributePresets("9,minutes", "1,raw48:54,Raw_Read_Error_Rate"),
+	)
+	require.Equal(t, []string{
+		"-B", "+testdata/drivedb-extra.h",
+		"-v", "9,minutes",
+		"-v", "1,raw48:54,Raw_Read_Error_Rate",
+	}, cmd.smartctlArgs[len(cmd.smartctlArgs)-6:])
+	require.NoError(t, cmd.CheckDriveDB(context.Background()))
+
+	cmd = NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"), WithDriveDB("testdata/missing.h"))
+	require.Error(t, cmd.CheckDriveDB(context.Background()))
+
+	cmd = NewCommand(WithSmartctlBinary("testdata/fake-smartctl.sh"), WithDriveDB("testdata/smartctl-version.json"))
+	require.EqualError(t, cmd.CheckDriveDB(context.Background()),
+		"command testdata/fake-smartctl.sh -B +testdata/smartctl-version.json -P showall failed: testdata/smartctl-version.json(1): Syntax error, '{' expected (error: exit status 1)")
+
+	require.NoError(t, NewCommand().CheckDriveDB(context.Background()))
+}
+
+func TestValidateAttributePreset(t *testing.T) {
+	for _, preset := range []string{"9,minutes", "1,raw48:54,Raw_Read_Error_Rate", "N,raw48", "194,tempminmax,Temperature_Celsius", "9,raw48,Power_On,HDD", "N,raw48,Foo,SSD"} {
+		require.NoError(t, ValidateAttributePreset(preset), preset)
+	}
+	for _, preset := range []string{"", "9", "0,raw48", "256,raw48", "1,raw48,Name,Extra", "9,raw48,HDD,", "1,raw48,Name,SSD,HDD", "-B,raw48", "1,raw 48"} {
+		require.Error(t, ValidateAttributePreset(preset), preset)
+	}
+}
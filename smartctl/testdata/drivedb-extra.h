@@ -0,0 +1,11 @@
+/*
+ * Additional drive database entries, see smartctl -B.
+ */
+{ "Example Drives", // model family
+  "EXAMPLE-DISK-[0-9]+", // model regexp
+  "", // any firmware
+  "", // no warning
+  "-v 1,raw48,Raw_Read_Error_Rate "
+  "-v 170,raw48,Available_Reservd_Space "
+  "-v 231,raw48,SSD_Life_Left"
+},
@@ -0,0 +1,12 @@
+#!/bin/sh
+# Fake smartctl 6.x, which does not support JSON output.
+for arg; do
+	case "$arg" in
+	--json*)
+		echo "=======> UNRECOGNIZED OPTION: json"
+		exit 1
+		;;
+	esac
+done
+echo "smartctl 6.6 2017-11-05 r4594 [x86_64-linux-4.19.0-6-amd64] (local build)"
+echo "Copyright (C) 2002-17, Bruce Allen, Christian Franke, www.smartmontools.org"
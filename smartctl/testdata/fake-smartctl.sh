@@ -0,0 +1,18 @@
+#!/bin/sh
+# Fake smartctl outputting the content of the file passed as last argument
+# (in place of the device), exiting with the status found in the JSON.
+# Version probes output testdata/smartctl-version.json, drive database checks
+# only accept files with entries.
+if [ "$1" = "--version" ]; then
+	cat "$(dirname "$0")/smartctl-version.json"
+	exit 0
+fi
+if [ "$1" = "-B" ] && [ "$3" = "-P" ]; then
+	db="${2#+}"
+	grep -q '^{ *"' "$db" && exit 0
+	echo "$db(1): Syntax error, '{' expected"
+	exit 1
+fi
+for last; do true; done
+cat "$last"
+exit "$(sed -n 's/.*"exit_status": *\([0-9]*\).*/\1/p' "$last")"
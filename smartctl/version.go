@@ -0,0 +1,97 @@
+package smartctl
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Version is a smartctl or JSON format version.
+type Version struct {
+	Major int
+	Minor int
+}
+
+var (
+	// MinimumVersion is the first smartctl release supporting JSON output.
+	MinimumVersion = Version{Major: 7, Minor: 0}
+	// RecommendedVersion is the first smartctl release reporting all the
+	// supported logs, e.g. NVMe error information and self-test logs.
+	RecommendedVersion = Version{Major: 7, Minor: 3}
+)
+
+// supportedJSONFormat is the JSON format major version the package decodes.
+const supportedJSONFormat = 1
+
+func (v Version) String() string {
+	if !v.Known() {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Known returns false when smartctl did not report its version.
+func (v Version) Known() bool {
+	return v != Version{}
+}
+
+// Less returns true when v is older than other.
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+// VersionInfo is the result of probing the smartctl binary.
+type VersionInfo struct {
+	Version    Version
+	JSONFormat Version // unknown when smartctl does not support JSON output
+}
+
+// Check returns an error when the smartctl binary cannot be used.
+func (i VersionInfo) Check() error {
+	if i.Version.Less(MinimumVersion) {
+		return fmt.Errorf("smartctl %s is not supported, JSON output requires smartctl %s or later", i.Version, MinimumVersion)
+	}
+	if i.JSONFormat.Major != supportedJSONFormat {
+		return fmt.Errorf("smartctl %s JSON format version %s is not supported, expected %d.x", i.Version, i.JSONFormat, supportedJSONFormat)
+	}
+	return nil
+}
+
+// Example: "smartctl 6.6 2017-11-05 r4594 [x86_64-linux-4.19.0-6-amd64] (local build)"
+var versionRegexp = regexp.MustCompile(`(?m)^smartctl (\d+)\.(\d+)`)
+
+// ProbeVersion reports the version of the smartctl binary. Releases without
+// JSON output are detected from the --version text output.
+func (c *Command) ProbeVersion(ctx context.Context) (VersionInfo, error) {
+	var out jsonVersionOutput
+	if _, err := c.run(ctx, &out, "--version", "--json=c"); err == nil {
+		return VersionInfo{
+			Version:    parseVersion(out.Smartctl.Version),
+			JSONFormat: parseVersion(out.JSONFormatVersion),
+		}, nil
+	}
+
+	result, err := c.execute(ctx, "--version")
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("command %s failed: %w", result.cmdline, richError(result, err))
+	}
+	match := versionRegexp.FindSubmatch(result.stdout)
+	if match == nil {
+		return VersionInfo{}, fmt.Errorf("command %s: unexpected output %q", result.cmdline, result.stdout)
+	}
+	major, _ := strconv.Atoi(string(match[1]))
+	minor, _ := strconv.Atoi(string(match[2]))
+	return VersionInfo{Version: Version{Major: major, Minor: minor}}, nil
+}
+
+// parseVersion converts a JSON version, e.g. [7, 2].
+func parseVersion(v []int) Version {
+	if len(v) < 2 {
+		return Version{}
+	}
+	return Version{Major: v[0], Minor: v[1]}
+}
@@ -6,11 +6,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/DataDog/datadog-go/statsd"
+
 	"github.com/j-vizcaino/datadog-smartctl/metric"
 )
 
-type statsdGauge interface {
+type statsdClient interface {
 	Gauge(string, float64, []string, float64) error
+	ServiceCheck(*statsd.ServiceCheck) error
 }
 
 type errorHandler func(err error)
@@ -19,14 +22,14 @@ type Submitter struct {
 	metricUpdates chan metric.DeviceMetrics
 	metricStore   []metric.DeviceMetrics
 
-	statsdClient statsdGauge
+	statsdClient statsdClient
 	errorHandler errorHandler
 
 	stop    chan bool
 	running sync.WaitGroup
 }
 
-func New(statsdClient statsdGauge, errorHandler errorHandler) *Submitter {
+func New(statsdClient statsdClient, errorHandler errorHandler) *Submitter {
 
 	return &Submitter{
 		metricUpdates: make(chan metric.DeviceMetrics, 16),
@@ -74,7 +77,10 @@ func (s *Submitter) periodicSubmit(period time.Duration) {
 
 func (s *Submitter) saveMetrics(updated metric.DeviceMetrics) {
 	for idx, existing := range s.metricStore {
-		if updated.DeviceName == existing.DeviceName {
+		if updated.DeviceID == existing.DeviceID && updated.Source == existing.Source {
+			if updated.Partial {
+				updated = mergeMetrics(existing, updated)
+			}
 			s.metricStore[idx] = updated
 			return
 		}
@@ -83,23 +89,56 @@ func (s *Submitter) saveMetrics(updated metric.DeviceMetrics) {
 	s.metricStore = append(s.metricStore, updated)
 }
 
+// mergeMetrics updates the existing metrics with the partial ones.
+func mergeMetrics(existing metric.DeviceMetrics, partial metric.DeviceMetrics) metric.DeviceMetrics {
+	merged := existing
+	merged.Entries = make([]metric.Metric, 0, len(existing.Entries)+len(partial.Entries))
+	updated := make(map[string]bool, len(partial.Entries))
+	for _, entry := range partial.Entries {
+		updated[entry.Name] = true
+	}
+	for _, entry := range existing.Entries {
+		if !updated[entry.Name] {
+			merged.Entries = append(merged.Entries, entry)
+		}
+	}
+	merged.Entries = append(merged.Entries, partial.Entries...)
+	return merged
+}
+
 func (s *Submitter) submitMetrics() {
 	var sampleErr error
 	errCount := 0
+	recordErr := func(err error) {
+		if err != nil {
+			errCount++
+			if sampleErr == nil {
+				sampleErr = err
+			}
+		}
+	}
 	for _, device := range s.metricStore {
 		for _, metricData := range device.Entries {
-			err := s.statsdClient.Gauge(
+			tags := device.CommonTags
+			if len(metricData.Tags) > 0 {
+				tags = make([]string, 0, len(device.CommonTags)+len(metricData.Tags))
+				tags = append(tags, device.CommonTags...)
+				tags = append(tags, metricData.Tags...)
+			}
+			recordErr(s.statsdClient.Gauge(
 				metricData.Name,
 				float64(metricData.Value),
-				device.CommonTags,
+				tags,
 				1.0,
-			)
-			if err != nil {
-				errCount++
-				if sampleErr == nil {
-					sampleErr = err
-				}
-			}
+			))
+		}
+		for _, check := range device.ServiceChecks {
+			recordErr(s.statsdClient.ServiceCheck(&statsd.ServiceCheck{
+				Name:    check.Name,
+				Status:  statsd.ServiceCheckStatus(check.Status),
+				Message: check.Message,
+				Tags:    device.CommonTags,
+			}))
 		}
 	}
 
@@ -2,24 +2,64 @@ package main
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/j-vizcaino/datadog-smartctl/converter"
 	"github.com/j-vizcaino/datadog-smartctl/poller"
+	"github.com/j-vizcaino/datadog-smartctl/selftest"
 	"github.com/j-vizcaino/datadog-smartctl/smartctl"
 	"github.com/j-vizcaino/datadog-smartctl/submitter"
 )
 
 func getDataTranslator(cfg Config, devConfig DeviceConfig, submit *submitter.Submitter) poller.OnNewDataFunc {
-	conv := converter.New(
-		cfg.Statsd.MetricsPrefix,
+	opts := []converter.Option{
 		converter.WithTags(cfg.Statsd.DeviceTags...),
+		converter.WithExitStatus(),
+		converter.WithHealth(),
+		converter.WithPowerMode(),
+		converter.WithSmartctlVersion(),
+		converter.WithQueryStats(),
+		converter.WithDeviceInfo(),
 		converter.WithATASmartAttributes(devConfig.ATASmartAttributesMetrics...),
 		converter.WithATADeviceStats(devConfig.ATADeviceStatsMetrics...),
 		converter.WithNVMeHealthInfo(devConfig.NVMeHealthInfoMetrics...),
-	)
+		converter.WithNVMeErrorInfoLog(devConfig.NVMeErrorInfoLogMetrics...),
+		converter.WithNVMeSelfTestLog(devConfig.NVMeSelfTestLogMetrics...),
+		converter.WithSATAPhyEventCounters(devConfig.SATAPhyEventCountersMetrics...),
+	}
+	if devConfig.ATASelfTestLog {
+		opts = append(opts, converter.WithATASelfTestLog())
+	}
+	if devConfig.ATAErrorLog {
+		opts = append(opts, converter.WithATAErrorLog())
+	}
+	if devConfig.ATASCTStatus {
+		opts = append(opts, converter.WithATASCTStatus())
+	}
+	if devConfig.ATASCTTemperatureHistory {
+		opts = append(opts, converter.WithATASCTTemperatureHistory())
+	}
+	if devConfig.SCSIGrownDefectList {
+		opts = append(opts, converter.WithSCSIGrownDefectList())
+	}
+	if devConfig.SCSIErrorCounterLog {
+		opts = append(opts, converter.WithSCSIErrorCounterLog())
+	}
+	if devConfig.SCSIStartStopCycleCounter {
+		opts = append(opts, converter.WithSCSIStartStopCycleCounter())
+	}
+	if devConfig.SCSIPercentageUsedEndurance {
+		opts = append(opts, converter.WithSCSIPercentageUsedEndurance())
+	}
+	if devConfig.SCSITemperature {
+		opts = append(opts, converter.WithSCSITemperature())
+	}
+	conv := converter.New(cfg.Statsd.MetricsPrefix, opts...)
 
 	return func(ctx context.Context, data smartctl.Data) {
 		metrics := conv.Convert(data)
@@ -27,25 +67,269 @@ func getDataTranslator(cfg Config, devConfig DeviceConfig, submit *submitter.Sub
 	}
 }
 
-func getDeviceQuerier(cfg SmartCtlConfig) poller.QueryDeviceFunc {
+func getSelfTestScheduler(cfg Config, devConfig DeviceConfig, smartCmd *smartctl.Command, submit *submitter.Submitter, offset time.Duration) *selftest.Scheduler {
+	conv := converter.New(
+		cfg.Statsd.MetricsPrefix,
+		converter.WithTags(cfg.Statsd.DeviceTags...),
+	)
+	onReport := func(ctx context.Context, data smartctl.Data, report selftest.Report) {
+		if report.Unsupported {
+			log.Error().Str("device", devConfig.Device().ID()).Msg("Device does not report ATA self-test status, self-tests are disabled")
+			return
+		}
+		submit.Update(ctx, conv.ConvertEntries(data, "self_test", report.Metrics()))
+	}
+	startSelfTest := func(ctx context.Context, device smartctl.Device, testType smartctl.SelfTestType) error {
+		logger := log.With().Str("device", device.ID()).Str("test_type", string(testType)).Logger()
+		logger.Info().Msg("Starting self-test")
+		err := smartCmd.StartSelfTest(ctx, device, testType)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Starting self-test failed")
+		}
+		return err
+	}
+
+	// Schedules are validated with the configuration
+	var schedules []selftest.Schedule
+	for _, scheduleConfig := range devConfig.SelfTests {
+		schedule, _ := scheduleConfig.Schedule()
+		schedules = append(schedules, schedule)
+	}
+	query := selftest.QueryDeviceFunc(getDeviceQuerier(smartCmd, nil))
+	return selftest.New(query, startSelfTest, onReport, devConfig.Device(), offset, schedules...)
+}
+
+func getSmartctlCommand(profile CommandProfile, logs []string, limiter *smartctl.Limiter) *smartctl.Command {
 	var opts []smartctl.CommandOption
 
-	if cfg.UseSudo {
-		opts = append(opts, smartctl.WithSudoEnabled())
+	if limiter != nil {
+		opts = append(opts, smartctl.WithLimiter(limiter))
+	}
+	if len(logs) > 0 {
+		opts = append(opts, smartctl.WithLogs(logs...))
+	}
+	if len(profile.ExtraArgs) > 0 {
+		opts = append(opts, smartctl.WithExtraArgs(profile.ExtraArgs...))
+	}
+	if profile.Timeout > 0 {
+		opts = append(opts, smartctl.WithTimeout(profile.Timeout))
+	}
+	// Executors are validated with the configuration
+	if executor, err := profile.ExecutorConfig().Executor(); err == nil {
+		opts = append(opts, smartctl.WithExecutor(executor))
+	}
+	if profile.Binary != "" {
+		opts = append(opts, smartctl.WithSmartctlBinary(profile.Binary))
+	}
+	if profile.SkipIfInPowerMode != "" {
+		opts = append(opts, smartctl.WithSkipIfInPowerMode(profile.SkipIfInPowerMode))
+	}
+	if profile.DriveDB != "" {
+		opts = append(opts, smartctl.WithDriveDB(profile.DriveDB))
+	}
+	if len(profile.AttributePresets) > 0 {
+		opts = append(opts, smartctl.WithAttributePresets(profile.AttributePresets...))
+	}
+	// Rules are validated with the configuration
+	if decoders, err := profile.RawDecoders(); err == nil {
+		opts = append(opts, smartctl.WithRawDecoders(decoders))
+	}
+	return smartctl.NewCommand(opts...)
+}
+
+// profileCommandLine returns how the profile runs smartctl, e.g.
+// "sudo -n smartctl".
+func profileCommandLine(profile CommandProfile) string {
+	executor, err := profile.ExecutorConfig().Executor()
+	if err != nil {
+		executor = smartctl.DirectExecutor{}
+	}
+	return strings.Join(executor.CommandLine(profile.Binary, nil), " ")
+}
+
+// checkSmartctlVersions probes each smartctl binary used by the profiles once.
+// Unsupported versions are fatal, unless allowed by the configuration.
+func checkSmartctlVersions(ctx context.Context, cfg SmartCtlConfig, profiles []CommandProfile) {
+	probed := make(map[string]bool)
+	for _, profile := range profiles {
+		command := profileCommandLine(profile)
+		if probed[command] {
+			continue
+		}
+		probed[command] = true
+
+		logger := log.With().Str("command", command).Logger()
+		info, err := getSmartctlCommand(profile, nil, nil).ProbeVersion(ctx)
+		if err == nil {
+			err = info.Check()
+		}
+		if err != nil {
+			event := logger.Fatal()
+			if cfg.AllowUnsupportedVersion {
+				event = logger.Warn()
+			}
+			event.Err(err).Msg("Unsupported smartctl binary")
+			continue
+		}
+
+		logger = logger.With().Stringer("version", info.Version).Logger()
+		if info.Version.Less(smartctl.RecommendedVersion) {
+			logger.Warn().
+				Stringer("recommended", smartctl.RecommendedVersion).
+				Msg("Outdated smartctl version, some logs are not available")
+		} else {
+			logger.Info().Msg("Detected smartctl version")
+		}
+	}
+}
+
+// checkDriveDBs makes sure smartctl loads the drive database file of each
+// profile, exiting otherwise.
+func checkDriveDBs(ctx context.Context, profiles []CommandProfile) {
+	checked := make(map[string]bool)
+	for _, profile := range profiles {
+		if profile.DriveDB == "" {
+			continue
+		}
+		key := profileCommandLine(profile) + ":" + profile.DriveDB
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		if err := getSmartctlCommand(profile, nil, nil).CheckDriveDB(ctx); err != nil {
+			log.Fatal().Err(err).Str("drivedb", profile.DriveDB).Msg("Invalid drive database")
+		}
+		log.Info().Str("drivedb", profile.DriveDB).Msg("Using additional drive database")
 	}
-	if cfg.Binary != "" {
-		opts = append(opts, smartctl.WithSmartctlBinary(cfg.Binary))
+}
+
+// deviceQuerier queries devices: smartctl.Command, or smartctl.HelperClient
+// when going through the privileged helper.
+type deviceQuerier interface {
+	QueryDevice(ctx context.Context, device smartctl.Device) (smartctl.Data, error)
+}
+
+// queryErrorReporter is called with the result of each device query, nil
+// when the query succeeded.
+type queryErrorReporter func(ctx context.Context, device smartctl.Device, err error)
+
+// getQueryErrorReporter submits the query error metrics of the devices.
+func getQueryErrorReporter(cfg Config, submit *submitter.Submitter) queryErrorReporter {
+	conv := converter.New(
+		cfg.Statsd.MetricsPrefix,
+		converter.WithTags(cfg.Statsd.DeviceTags...),
+	)
+	return func(ctx context.Context, device smartctl.Device, err error) {
+		submit.Update(ctx, conv.ConvertQueryError(device, err))
 	}
-	smartCmd := smartctl.NewCommand(opts...)
+}
 
-	return func(ctx context.Context, device string) (smartctl.Data, error) {
-		logger := log.With().Str("device", device).Logger()
+// getDeviceQuerier returns the query function of a single device, called by
+// its poller.
+func getDeviceQuerier(smartCmd deviceQuerier, reportError queryErrorReporter) poller.QueryDeviceFunc {
+	// Missing fields and duplicate attributes are only worth a warning when
+	// they change: some devices always have them
+	var missingFields, duplicates string
+	return func(ctx context.Context, device smartctl.Device) (smartctl.Data, error) {
+		logger := log.With().Str("device", device.ID()).Logger()
 		logger.Info().Msg("Querying SMART information")
 		data, err := smartCmd.QueryDevice(ctx, device)
+		if reportError != nil {
+			reportError(ctx, device, err)
+		}
 		if err != nil {
-			logger.Warn().Err(err).Msg("Querying SMART information failed")
+			logger.Warn().Err(err).Str("error_class", smartctl.ErrorClass(err)).Msg("Querying SMART information failed")
+			return data, err
+		}
+		if data.Skipped {
+			logger.Info().Stringer("power_mode", data.PowerMode).Msg("Device skipped, not spinning it up")
+			return data, nil
+		}
+		if level, ok := warnOnChange(&missingFields, data.MissingFields); ok {
+			logger.WithLevel(level).Strs("fields", data.MissingFields).Msg("smartctl output is missing fields, metrics will be incomplete")
+		}
+		if level, ok := warnOnChange(&duplicates, data.ATASmartAttributesDuplicates); ok {
+			logger.WithLevel(level).
+				Strs("names", data.ATASmartAttributesDuplicates).
+				Msg("Several ATA SMART attributes share the same name, select them by ID")
+		}
+		return data, nil
+	}
+}
+
+// warnOnChange returns the level of a message about the values, false when
+// there are none: warning when they differ from the previous ones, debug
+// otherwise. previous is updated.
+func warnOnChange(previous *string, values []string) (zerolog.Level, bool) {
+	current := strings.Join(values, ",")
+	changed := current != *previous
+	*previous = current
+	switch {
+	case current == "":
+		return zerolog.NoLevel, false
+	case changed:
+		return zerolog.WarnLevel, true
+	}
+	return zerolog.DebugLevel, true
+}
+
+// discoverDevices scans the host for devices and returns the configuration of
+// the ones matching the discovery settings, skipping explicitly configured devices.
+func discoverDevices(ctx context.Context, smartCmd *smartctl.Command, cfg Config) []DeviceConfig {
+	scanned, err := smartCmd.ScanDevices(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Device discovery failed")
+		return nil
+	}
+
+	configured := make(map[string]bool, len(cfg.Devices))
+	for _, dev := range cfg.MonitoredDevices() {
+		configured[dev.Device().ID()] = true
+	}
+
+	var out []DeviceConfig
+	for _, dev := range cfg.Discovery.Filter().Filter(scanned) {
+		device := dev.Device()
+		logger := log.With().
+			Str("device", device.ID()).
+			Str("protocol", dev.Protocol).
+			Logger()
+		if configured[device.ID()] {
+			continue
+		}
+		if dev.OpenError != "" {
+			logger.Warn().Str("error", dev.OpenError).Msg("Ignoring discovered device that cannot be opened")
+			continue
+		}
+		metrics, ok := cfg.Discovery.ProtocolMetrics(dev.Protocol)
+		if !ok {
+			logger.Info().Msg("Ignoring discovered device, no metrics configured for its protocol")
+			continue
+		}
+		logger.Info().Msg("Discovered device")
+		out = append(out, DeviceConfig{
+			Path:           device.Path,
+			CommandProfile: cfg.Smartctl.CommandProfile().Merge(CommandProfile{Type: device.Type}),
+			MetricsConfig:  metrics,
+		})
+	}
+	return out
+}
+
+// reportLimiterStats periodically submits the number of queries running and
+// waiting for the limiter, until the context is done.
+func reportLimiterStats(ctx context.Context, cfg StatsdConfig, limiter *smartctl.Limiter, submit *submitter.Submitter) {
+	conv := converter.New(cfg.MetricsPrefix)
+	ticker := time.NewTicker(cfg.ReportInterval)
+	defer ticker.Stop()
+	for {
+		submit.Update(ctx, conv.ConvertLimiterStats(limiter.Stats()))
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
 		}
-		return data, err
 	}
 }
 
@@ -76,9 +360,8 @@ func getSubmitter(cfg StatsdConfig) (*submitter.Submitter, func()) {
 
 func testDeviceQuery() poller.QueryDeviceFunc {
 	out, _ := ioutil.ReadFile("smartctl/testdata/smartctl-output-wd-red.json")
-	obj := objx.MustFromJSON(string(out))
-	d, err := smartctl.NewData(obj)
-	return func(ctx context.Context, dev string) (smartctl.Data, error) {
+	d, err := smartctl.NewData(out)
+	return func(ctx context.Context, dev smartctl.Device) (smartctl.Data, error) {
 		return d, err
 	}
 }